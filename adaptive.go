@@ -0,0 +1,61 @@
+package supervisor
+
+import (
+	"math"
+	"time"
+)
+
+// AdaptiveBackoffConfig configures AdaptiveBackoff.
+type AdaptiveBackoffConfig struct {
+	// HalfLife is the number of runs after which a run's outcome counts
+	// for half as much in the crash rate. Smaller values react faster to
+	// a change in behavior. Zero means 4.
+	HalfLife int
+}
+
+// AdaptiveBackoff returns a backoff strategy driven by the worker's recent
+// crash rate rather than by how many restarts there have been. The rate is
+// an exponentially weighted moving average of the run outcomes, failed runs
+// counting as 1 and clean ones as 0, and the backoff scales geometrically
+// with it from MinBackoff (no recent crashes) to MaxBackoff (only crashes).
+// A worker that mostly succeeds therefore restarts quickly even after an
+// occasional crash, and one that keeps crashing backs off toward
+// MaxBackoff. Jitter and JitterMode apply as usual; BackoffFactor,
+// BackoffReset, ShouldResetBackoff and MaxAttemptsForBackoff are ignored.
+func AdaptiveBackoff(cfg AdaptiveBackoffConfig) BackoffStrategy {
+	return &adaptive{conf: cfg, cfg: DefaultConfig()}
+}
+
+type adaptive struct {
+	conf AdaptiveBackoffConfig
+	cfg  Config
+	rate float64 // weighted share of recent runs that failed
+}
+
+func (a *adaptive) bind(cfg Config) BackoffStrategy {
+	return &adaptive{conf: a.conf, cfg: cfg}
+}
+
+func (a *adaptive) setBounds(min, max time.Duration) {
+	a.cfg.MinBackoff, a.cfg.MaxBackoff = min, max
+}
+
+func (a *adaptive) Next(exit ExitInfo) time.Duration {
+	halfLife := a.conf.HalfLife
+	if halfLife <= 0 {
+		halfLife = 4
+	}
+	alpha := 1 - math.Exp2(-1/float64(halfLife))
+
+	outcome := 0.0
+	if exit.Failed() {
+		outcome = 1
+	}
+	a.rate += alpha * (outcome - a.rate)
+
+	min, max := a.cfg.MinBackoff, a.cfg.MaxBackoff
+	d := float64(min) * math.Pow(float64(max)/float64(min), a.rate)
+	d = math.Max(math.Min(d, float64(max)), float64(min))
+	mode := a.cfg.JitterMode
+	return mode.apply(jittered(d, min, max, mode.proportional(a.cfg.Jitter), nil), nil)
+}
@@ -0,0 +1,57 @@
+package supervisor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Test that the adaptive backoff grows while crashes dominate and shrinks
+// as clean runs take over.
+func TestAdaptiveBackoff(t *testing.T) {
+	b := AdaptiveBackoff(AdaptiveBackoffConfig{HalfLife: 1}).(bindable).bind(Config{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Second,
+	})
+
+	crash := ExitInfo{Reason: ExitPanic, Err: &PanicError{Value: "boom"}}
+	clean := ExitInfo{Reason: ExitClean}
+
+	var prev time.Duration
+	for i := 0; i < 4; i++ {
+		d := b.Next(crash)
+		if d <= prev {
+			t.Fatalf("crash %d: expected backoff to grow past %v, got %v", i+1, prev, d)
+		}
+		prev = d
+	}
+	if prev > time.Second {
+		t.Fatalf("backoff %v exceeds MaxBackoff", prev)
+	}
+
+	for i := 0; i < 4; i++ {
+		d := b.Next(clean)
+		if d >= prev {
+			t.Fatalf("clean run %d: expected backoff to shrink below %v, got %v", i+1, prev, d)
+		}
+		prev = d
+	}
+	if prev < time.Millisecond {
+		t.Fatalf("backoff %v below MinBackoff", prev)
+	}
+}
+
+// Test that a single crash among clean runs barely raises the backoff.
+func TestAdaptiveBackoffOccasionalCrash(t *testing.T) {
+	b := AdaptiveBackoff(AdaptiveBackoffConfig{}).(bindable).bind(Config{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Second,
+	})
+
+	for i := 0; i < 20; i++ {
+		b.Next(ExitInfo{Reason: ExitClean})
+	}
+	if d := b.Next(ExitInfo{Reason: ExitError, Err: errors.New("boom")}); d > 10*time.Millisecond {
+		t.Fatalf("expected a short backoff after one crash, got %v", d)
+	}
+}
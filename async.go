@@ -0,0 +1,85 @@
+package supervisor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type asyncKey struct{}
+
+// asyncWork tracks the background work started by hooks with Async.
+type asyncWork struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	n      int  // work still running
+	closed bool // set once the supervisor has begun waiting
+}
+
+// Async runs fn in a new goroutine on behalf of the hook that ctx was
+// passed to, such as an Observer method or Config.OnRestart. When the
+// supervisor stops, it waits for such work to finish, up to
+// Config.ShutdownTimeout, before it logs "stopped", calls OnStop and
+// returns from Wait, so that side effects like an asynchronous metrics
+// flush are not lost. A panic in fn is logged and otherwise ignored.
+//
+// Async reports whether fn was started. It does nothing and returns false
+// if ctx was not passed to a hook, or if the supervisor has already
+// stopped waiting for hook work.
+func Async(ctx context.Context, fn func()) bool {
+	s, ok := ctx.Value(asyncKey{}).(*Supervisor)
+	if !ok {
+		return false
+	}
+
+	s.async.mu.Lock()
+	defer s.async.mu.Unlock()
+	if s.async.closed {
+		return false
+	}
+	s.async.wg.Add(1)
+	s.async.n++
+	go func() {
+		defer func() {
+			s.async.mu.Lock()
+			s.async.n--
+			s.async.mu.Unlock()
+			s.async.wg.Done()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				s.logf("async hook work panicked: %s", s.cfg.FormatPanic(r))
+			}
+		}()
+		fn()
+	}()
+	return true
+}
+
+// waitAsync waits up to ShutdownTimeout for the work started with Async,
+// after which no more can be started.
+func (s *Supervisor) waitAsync() {
+	s.async.mu.Lock()
+	s.async.closed = true
+	pending := s.async.n
+	s.async.mu.Unlock()
+	if pending == 0 {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.async.wg.Wait()
+		close(done)
+	}()
+
+	timeout := s.cfg.ShutdownTimeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	select {
+	case <-done:
+	case <-s.cfg.After(timeout):
+		s.logf("timed out waiting for async hook work")
+	}
+}
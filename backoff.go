@@ -0,0 +1,289 @@
+package supervisor
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// NextBackoff returns the delay to wait before the next restart, given the
+// delay that was used before the previous one.
+//
+// This is the algorithm the supervisor uses internally with the default
+// Config.BackoffFactor: prev is doubled and clamped to [min, max]; a prev
+// of zero yields min. If jitter is positive the result is then randomly
+// spread by up to +/- jitter (a fraction, capped at 1.0) and clamped to
+// [min, max] again. Random numbers are drawn from rng, or from the
+// top-level math/rand/v2 source when rng is nil.
+func NextBackoff(prev, min, max time.Duration, jitter float64, rng *rand.Rand) time.Duration {
+	return nextBackoff(prev, min, max, defaultBackoffFactor, jitter, rng)
+}
+
+// defaultBackoffFactor is the growth factor used when
+// Config.BackoffFactor is unset or invalid.
+const defaultBackoffFactor = 2.0
+
+// nextBackoff is NextBackoff with a configurable growth factor.
+func nextBackoff(prev, min, max time.Duration, factor, jitter float64, rng *rand.Rand) time.Duration {
+	next := math.Min(float64(prev)*factor, float64(max))
+	next = math.Max(next, float64(min))
+	return jittered(next, min, max, jitter, rng)
+}
+
+// jittered spreads d by up to +/- jitter as NextBackoff describes and
+// clamps the result to [min, max].
+func jittered(d float64, min, max time.Duration, jitter float64, rng *rand.Rand) time.Duration {
+	if jitter > 0 {
+		if jitter > 1 {
+			jitter = 1
+		}
+		var f float64
+		if rng != nil {
+			f = rng.Float64()
+		} else {
+			f = rand.Float64()
+		}
+		d *= 1 + jitter*(2*f-1)
+		d = math.Max(math.Min(d, float64(max)), float64(min))
+	}
+	return time.Duration(d)
+}
+
+// JitterMode selects how Config.Jitter randomizes each backoff.
+type JitterMode int
+
+const (
+	// JitterProportional spreads the backoff by up to +/- Config.Jitter,
+	// as NextBackoff describes. It is the default; with a Jitter of zero
+	// it adds no randomness.
+	JitterProportional JitterMode = iota
+
+	// JitterNone uses the computed backoff as is, ignoring Config.Jitter.
+	JitterNone
+
+	// JitterFull waits a random duration in [0, computed backoff].
+	JitterFull
+
+	// JitterEqual waits half the computed backoff plus a random duration
+	// in [0, half the computed backoff].
+	JitterEqual
+)
+
+func (m JitterMode) String() string {
+	switch m {
+	case JitterProportional:
+		return "proportional"
+	case JitterNone:
+		return "none"
+	case JitterFull:
+		return "full"
+	case JitterEqual:
+		return "equal"
+	default:
+		return "unknown"
+	}
+}
+
+// proportional returns jitter if m spreads the backoff proportionally,
+// and zero otherwise.
+func (m JitterMode) proportional(jitter float64) float64 {
+	if m != JitterProportional {
+		return 0
+	}
+	return jitter
+}
+
+// apply randomizes d for JitterFull and JitterEqual and returns it
+// unchanged for the other modes. The result may fall below MinBackoff.
+func (m JitterMode) apply(d time.Duration, rng *rand.Rand) time.Duration {
+	var f float64
+	switch m {
+	case JitterFull, JitterEqual:
+		if rng != nil {
+			f = rng.Float64()
+		} else {
+			f = rand.Float64()
+		}
+	default:
+		return d
+	}
+	if m == JitterFull {
+		return time.Duration(float64(d) * f)
+	}
+	return d/2 + time.Duration(float64(d/2)*f)
+}
+
+// BackoffReset is a policy for when the backoff returns to MinBackoff. Use
+// one of NeverReset, ResetOnCleanExit or ResetAfterStableRun; exactly one
+// policy applies to a supervisor.
+type BackoffReset struct {
+	mode   resetMode
+	stable time.Duration
+}
+
+type resetMode int
+
+const (
+	resetNever resetMode = iota
+	resetOnCleanExit
+	resetAfterStableRun
+)
+
+var (
+	// NeverReset keeps the backoff growing across all restarts, up to
+	// MaxBackoff. It is the default.
+	NeverReset = BackoffReset{mode: resetNever}
+
+	// ResetOnCleanExit resets the backoff after a run that returned
+	// without panicking or failing, so only consecutive failures escalate.
+	ResetOnCleanExit = BackoffReset{mode: resetOnCleanExit}
+)
+
+// ResetAfterStableRun resets the backoff after any run, failed or not,
+// that lasted at least d: a worker that stayed up that long is considered
+// to have recovered, so its next crash starts again from MinBackoff.
+func ResetAfterStableRun(d time.Duration) BackoffReset {
+	return BackoffReset{mode: resetAfterStableRun, stable: d}
+}
+
+// resets reports whether a run that ended as described resets the backoff.
+func (r BackoffReset) resets(failed bool, ran time.Duration) bool {
+	switch r.mode {
+	case resetOnCleanExit:
+		return !failed
+	case resetAfterStableRun:
+		return ran >= r.stable
+	default:
+		return false
+	}
+}
+
+// BackoffStrategy chooses the delay before each restart. Set
+// Config.Backoff to replace the built-in exponential backoff.
+type BackoffStrategy interface {
+	// Next returns how long to wait before restarting after the run
+	// described by exit. It is only called from the supervisor goroutine.
+	Next(exit ExitInfo) time.Duration
+}
+
+// bindable is implemented by the built-in strategies, which return a
+// fresh instance with their own state for each supervisor and can read
+// the supervisor's backoff settings.
+type bindable interface {
+	bind(cfg Config) BackoffStrategy
+}
+
+// rebounder is implemented by the built-in strategies so that
+// Supervisor.SetBackoffBounds can change their bounds in place, keeping
+// their state.
+type rebounder interface {
+	setBounds(min, max time.Duration)
+}
+
+// resetter is implemented by the built-in strategies that honor
+// Config.ShouldResetBackoff.
+type resetter interface {
+	reset()
+}
+
+// bindBackoff returns the strategy a supervisor with cfg should use.
+func bindBackoff(cfg Config) BackoffStrategy {
+	switch b := cfg.Backoff.(type) {
+	case nil:
+		return newExponential(cfg)
+	case bindable:
+		return b.bind(cfg)
+	default:
+		return b
+	}
+}
+
+// exponential is the default strategy: the backoff grows by BackoffFactor
+// from MinBackoff to MaxBackoff, honoring Jitter, JitterMode,
+// MaxAttemptsForBackoff, BackoffReset and BackoffDecay.
+type exponential struct {
+	cfg    Config
+	prev   time.Duration
+	growth int // backoff steps taken since the backoff was reset
+}
+
+func newExponential(cfg Config) *exponential {
+	return &exponential{cfg: cfg}
+}
+
+func (b *exponential) Next(exit ExitInfo) time.Duration {
+	if b.cfg.BackoffReset.resets(exit.Failed(), exit.Duration) {
+		b.reset()
+	}
+	if d := b.cfg.BackoffDecay; d > 0 {
+		for range exit.Duration / d {
+			if b.prev == 0 {
+				break
+			}
+			b.prev = time.Duration(float64(b.prev) / b.cfg.BackoffFactor)
+			b.growth--
+			if b.prev < b.cfg.MinBackoff {
+				b.reset()
+			}
+		}
+	}
+	if b.cfg.MaxAttemptsForBackoff <= 0 || b.growth < b.cfg.MaxAttemptsForBackoff {
+		jitter := b.cfg.JitterMode.proportional(b.cfg.Jitter)
+		b.prev = nextBackoff(b.prev, b.cfg.MinBackoff, b.cfg.MaxBackoff, b.cfg.BackoffFactor, jitter, nil)
+		b.growth++
+	}
+	// Full and equal jitter are applied to each wait rather than fed back
+	// into prev, so they do not slow the growth of the backoff.
+	return b.cfg.JitterMode.apply(b.prev, nil)
+}
+
+func (b *exponential) setBounds(min, max time.Duration) {
+	b.cfg.MinBackoff, b.cfg.MaxBackoff = min, max
+}
+
+// reset returns the backoff to MinBackoff.
+func (b *exponential) reset() {
+	b.prev, b.growth = 0, 0
+}
+
+// FastThenExponential returns a backoff strategy with two phases: the
+// first fastRetries restarts wait fastDelay each, for transient blips,
+// after which the backoff grows exponentially from MinBackoff as usual,
+// for sustained failures. The fast phase starts over whenever
+// BackoffReset resets the backoff. Jitter and the other backoff settings
+// apply to the exponential phase only.
+func FastThenExponential(fastRetries int, fastDelay time.Duration) BackoffStrategy {
+	return &fastThenExponential{retries: fastRetries, delay: fastDelay, exp: newExponential(DefaultConfig())}
+}
+
+type fastThenExponential struct {
+	retries int
+	delay   time.Duration
+	exp     *exponential
+	fast    int // fast retries used since the backoff was reset
+}
+
+func (f *fastThenExponential) bind(cfg Config) BackoffStrategy {
+	return &fastThenExponential{retries: f.retries, delay: f.delay, exp: newExponential(cfg)}
+}
+
+func (f *fastThenExponential) setBounds(min, max time.Duration) {
+	f.exp.setBounds(min, max)
+}
+
+// reset starts over with the fast phase.
+func (f *fastThenExponential) reset() {
+	f.fast = 0
+	f.exp.reset()
+}
+
+func (f *fastThenExponential) Next(exit ExitInfo) time.Duration {
+	if f.exp.cfg.BackoffReset.resets(exit.Failed(), exit.Duration) {
+		f.fast = 0
+	}
+	if f.fast < f.retries {
+		f.fast++
+		return f.delay
+	}
+	return f.exp.Next(exit)
+}
@@ -0,0 +1,279 @@
+package supervisor
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// Test that NextBackoff doubles the previous delay within bounds.
+func TestNextBackoffDoubles(t *testing.T) {
+	min, max := 10*time.Millisecond, 100*time.Millisecond
+
+	cases := []struct {
+		prev, want time.Duration
+	}{
+		{0, min},
+		{min, 20 * time.Millisecond},
+		{40 * time.Millisecond, 80 * time.Millisecond},
+		{80 * time.Millisecond, max},
+		{max, max},
+	}
+
+	for _, c := range cases {
+		if got := NextBackoff(c.prev, min, max, 0, nil); got != c.want {
+			t.Errorf("NextBackoff(%v) = %v, want %v", c.prev, got, c.want)
+		}
+	}
+}
+
+// Test that jitter stays within the requested fraction and the bounds.
+func TestNextBackoffJitter(t *testing.T) {
+	min, max := 10*time.Millisecond, time.Second
+	rng := rand.New(rand.NewPCG(1, 2))
+
+	for i := 0; i < 1000; i++ {
+		got := NextBackoff(50*time.Millisecond, min, max, 0.5, rng)
+		if got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("jittered backoff %v outside [50ms, 150ms]", got)
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		got := NextBackoff(max, min, max, 0.5, rng)
+		if got < max/2 || got > max {
+			t.Fatalf("jittered backoff %v outside [%v, %v]", got, max/2, max)
+		}
+	}
+}
+
+// runBackoffs supervises worker with cfg until it gives up and returns the
+// backoff waits it made.
+func runBackoffs(cfg Config, worker func(ctx context.Context)) []time.Duration {
+	after, recorded := recordBackoffs()
+	cfg.After = after
+	cfg.Logger = discardLogger
+
+	Start(context.Background(), cfg, worker).Wait()
+	return recorded()
+}
+
+func equalDurations(a, b []time.Duration) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Test each BackoffReset policy against the same alternating worker.
+func TestBackoffReset(t *testing.T) {
+	ms := time.Millisecond
+
+	cases := []struct {
+		name  string
+		reset BackoffReset
+		want  []time.Duration
+	}{
+		{"NeverReset", NeverReset, []time.Duration{ms, 2 * ms, 4 * ms, 8 * ms}},
+		{"ResetOnCleanExit", ResetOnCleanExit, []time.Duration{ms, ms, 2 * ms, ms}},
+		{"ResetAfterStableRun", ResetAfterStableRun(20 * ms), []time.Duration{ms, 2 * ms, ms, 2 * ms}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			runs := 0
+			// Runs alternate: panic quickly, return cleanly, panic after a
+			// long run, return cleanly, panic quickly.
+			got := runBackoffs(Config{
+				MinBackoff:   ms,
+				MaxBackoff:   time.Hour,
+				MaxRestarts:  4,
+				BackoffReset: c.reset,
+			}, func(ctx context.Context) {
+				runs++
+				switch runs {
+				case 2, 4:
+					return
+				case 3:
+					time.Sleep(30 * ms)
+				}
+				panic("boom")
+			})
+
+			if !equalDurations(got, c.want) {
+				t.Fatalf("expected backoffs %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
+// Test that ShouldResetBackoff resets the backoff for the runs it
+// selects, here clean runs that lasted a while.
+func TestShouldResetBackoff(t *testing.T) {
+	ms := time.Millisecond
+	runs := 0
+
+	// Runs: panic, return quickly, panic, return after a long run, panic.
+	got := runBackoffs(Config{
+		MinBackoff:  ms,
+		MaxBackoff:  time.Hour,
+		MaxRestarts: 4,
+		ShouldResetBackoff: func(a Attempt) bool {
+			return a.ExitReason == ExitClean && a.EndedAt.Sub(a.StartedAt) >= 20*ms
+		},
+	}, func(ctx context.Context) {
+		runs++
+		switch runs {
+		case 2:
+			return
+		case 4:
+			time.Sleep(30 * ms)
+			return
+		}
+		panic("boom")
+	})
+
+	want := []time.Duration{ms, 2 * ms, 4 * ms, ms}
+	if !equalDurations(got, want) {
+		t.Fatalf("expected backoffs %v, got %v", want, got)
+	}
+}
+
+// Test that ImmediateFirstRetry skips the first backoff and starts growth
+// from the second restart.
+func TestImmediateFirstRetry(t *testing.T) {
+	ms := time.Millisecond
+
+	got := runBackoffs(Config{
+		MinBackoff:          ms,
+		MaxBackoff:          time.Hour,
+		MaxRestarts:         4,
+		ImmediateFirstRetry: true,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+
+	want := []time.Duration{0, ms, 2 * ms, 4 * ms}
+	if !equalDurations(got, want) {
+		t.Fatalf("expected backoffs %v, got %v", want, got)
+	}
+}
+
+// Test that FastRestartOn skips the backoff for matching panics only.
+func TestFastRestartOn(t *testing.T) {
+	ms := time.Millisecond
+	runs := 0
+
+	got := runBackoffs(Config{
+		MinBackoff:  ms,
+		MaxBackoff:  time.Hour,
+		MaxRestarts: 4,
+		FastRestartOn: func(v any) bool {
+			return v == "reconnect"
+		},
+	}, func(ctx context.Context) {
+		runs++
+		if runs%2 == 0 {
+			panic("reconnect")
+		}
+		panic("boom")
+	})
+
+	want := []time.Duration{ms, 0, 2 * ms, 0}
+	if !equalDurations(got, want) {
+		t.Fatalf("expected backoffs %v, got %v", want, got)
+	}
+}
+
+// Test that BackoffDecay lowers the backoff by one step per period of
+// uptime.
+func TestBackoffDecay(t *testing.T) {
+	ms := time.Millisecond
+	runs := 0
+
+	got := runBackoffs(Config{
+		MinBackoff:   ms,
+		MaxBackoff:   time.Hour,
+		MaxRestarts:  4,
+		BackoffDecay: 20 * ms,
+	}, func(ctx context.Context) {
+		runs++
+		if runs == 4 {
+			time.Sleep(45 * ms) // two decay periods
+		}
+		panic("boom")
+	})
+
+	want := []time.Duration{ms, 2 * ms, 4 * ms, 2 * ms}
+	if !equalDurations(got, want) {
+		t.Fatalf("expected backoffs %v, got %v", want, got)
+	}
+}
+
+// Test that FastThenExponential retries quickly before backing off
+// exponentially, and starts over after a reset.
+func TestFastThenExponential(t *testing.T) {
+	ms := time.Millisecond
+	runs := 0
+
+	got := runBackoffs(Config{
+		MinBackoff:   10 * ms,
+		MaxBackoff:   time.Hour,
+		MaxRestarts:  6,
+		BackoffReset: ResetOnCleanExit,
+		Backoff:      FastThenExponential(2, ms),
+	}, func(ctx context.Context) {
+		runs++
+		if runs == 5 {
+			return
+		}
+		panic("boom")
+	})
+
+	want := []time.Duration{ms, ms, 10 * ms, 20 * ms, ms, ms}
+	if !equalDurations(got, want) {
+		t.Fatalf("expected backoffs %v, got %v", want, got)
+	}
+}
+
+// Test that each JitterMode keeps the backoff within its range and that
+// full and equal jitter do not slow its growth.
+func TestJitterMode(t *testing.T) {
+	ms := time.Millisecond
+	exit := ExitInfo{Reason: ExitPanic, Err: &PanicError{Value: "boom"}}
+
+	cases := []struct {
+		mode JitterMode
+		low  func(d time.Duration) time.Duration
+	}{
+		{JitterNone, func(d time.Duration) time.Duration { return d }},
+		{JitterFull, func(d time.Duration) time.Duration { return 0 }},
+		{JitterEqual, func(d time.Duration) time.Duration { return d / 2 }},
+	}
+
+	for _, c := range cases {
+		t.Run(c.mode.String(), func(t *testing.T) {
+			b := newExponential(Config{
+				MinBackoff:    ms,
+				MaxBackoff:    time.Hour,
+				BackoffFactor: 2,
+				Jitter:        0.5,
+				JitterMode:    c.mode,
+			})
+			want := ms
+			for range 10 {
+				got := b.Next(exit)
+				if got < c.low(want) || got > want {
+					t.Fatalf("expected backoff in [%v, %v], got %v", c.low(want), want, got)
+				}
+				want *= 2
+			}
+		})
+	}
+}
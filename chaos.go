@@ -0,0 +1,40 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+)
+
+// ErrChaos is the value ChaosWorker panics with, so that tests can tell
+// injected crashes from real ones.
+var ErrChaos = errors.New("supervisor: injected chaos panic")
+
+// ChaosWorker wraps worker for resilience testing: each run panics with
+// ErrChaos, before worker is called, with probability rate (0 never, 1
+// always). Random numbers are drawn from rng, or from the top-level
+// math/rand/v2 source when rng is nil; pass a seeded rng for reproducible
+// tests. The wrapper serializes its use of rng, so it may be shared
+// between supervisors.
+func ChaosWorker(worker func(ctx context.Context), rate float64, rng *rand.Rand) func(ctx context.Context) {
+	if worker == nil {
+		panic(nilWorkerPanic)
+	}
+
+	var mu sync.Mutex
+	crash := func() bool {
+		if rng == nil {
+			return rand.Float64() < rate
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return rng.Float64() < rate
+	}
+	return func(ctx context.Context) {
+		if crash() {
+			panic(ErrChaos)
+		}
+		worker(ctx)
+	}
+}
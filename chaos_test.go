@@ -0,0 +1,38 @@
+package supervisor
+
+import (
+	"context"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// Test that ChaosWorker injects the same panics for the same seed and
+// runs the worker otherwise.
+func TestChaosWorker(t *testing.T) {
+	run := func() (panics, runs int) {
+		rec := NewRecorder()
+		worker := ChaosWorker(func(ctx context.Context) { runs++ }, 0.5, rand.New(rand.NewPCG(1, 2)))
+		Run(context.Background(), Config{
+			MinBackoff:  time.Millisecond,
+			MaxBackoff:  time.Millisecond,
+			MaxRestarts: 19,
+			Logger:      discardLogger,
+			Observer:    rec,
+		}, worker)
+		for _, r := range rec.Events() {
+			if r.Kind == RecordPanic && r.Panic.Value != ErrChaos {
+				t.Fatalf("expected ErrChaos, got %v", r.Panic.Value)
+			}
+		}
+		return rec.Count(RecordPanic), runs
+	}
+
+	panics, runs := run()
+	if panics == 0 || runs == 0 || panics+runs != 20 {
+		t.Fatalf("expected a mix of 20 panics and runs, got %d and %d", panics, runs)
+	}
+	if p, r := run(); p != panics || r != runs {
+		t.Fatalf("expected the same seed to give %d panics, got %d", panics, p)
+	}
+}
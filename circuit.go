@@ -0,0 +1,118 @@
+package supervisor
+
+import "time"
+
+// CircuitBreakerConfig configures CircuitBreaker.
+type CircuitBreakerConfig struct {
+	// Threshold is the number of failed runs within Window that opens
+	// the circuit. Zero or a negative value means
+	// DefaultCircuitThreshold.
+	Threshold int
+
+	// Window is the sliding window failures are counted over. Zero counts
+	// failures since the circuit last closed.
+	Window time.Duration
+
+	// Cooldown is how long the circuit stays open before a trial run.
+	Cooldown time.Duration
+
+	// StableThreshold is how long the trial run must stay up for the
+	// circuit to close again. If the trial ends sooner, the circuit
+	// reopens for another Cooldown.
+	StableThreshold time.Duration
+}
+
+// DefaultCircuitThreshold is the Threshold a CircuitBreakerConfig uses
+// when none is set.
+const DefaultCircuitThreshold = 5
+
+// CircuitBreaker returns a backoff strategy that behaves like the default
+// exponential backoff while the circuit is closed. Once Threshold runs have
+// failed within Window, the circuit opens: no restart is attempted for
+// Cooldown, after which a single trial run is made with the circuit half
+// open. The circuit closes, resuming normal backoff from MinBackoff, only if
+// the trial stays up for StableThreshold.
+//
+// While the circuit is open or half open, Supervisor.State reports
+// StateCircuitOpen or StateHalfOpen.
+func CircuitBreaker(cfg CircuitBreakerConfig) BackoffStrategy {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = DefaultCircuitThreshold
+	}
+	return &circuitBreaker{conf: cfg, exp: newExponential(DefaultConfig())}
+}
+
+type circuitPhase int
+
+const (
+	circuitClosed circuitPhase = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+type circuitBreaker struct {
+	conf     CircuitBreakerConfig
+	exp      *exponential
+	phase    circuitPhase
+	failures []time.Time
+}
+
+func (cb *circuitBreaker) bind(cfg Config) BackoffStrategy {
+	return &circuitBreaker{conf: cb.conf, exp: newExponential(cfg)}
+}
+
+func (cb *circuitBreaker) setBounds(min, max time.Duration) {
+	cb.exp.setBounds(min, max)
+}
+
+// reset resets the backoff used while the circuit is closed. It leaves the
+// circuit itself alone.
+func (cb *circuitBreaker) reset() {
+	cb.exp.reset()
+}
+
+func (cb *circuitBreaker) Next(exit ExitInfo) time.Duration {
+	if cb.phase == circuitHalfOpen {
+		if exit.Duration < cb.conf.StableThreshold {
+			cb.phase = circuitOpen
+			return cb.conf.Cooldown
+		}
+		cb.phase = circuitClosed
+		cb.failures = nil
+		cb.exp.reset()
+	}
+
+	if exit.Failed() {
+		now := time.Now()
+		cb.failures = append(cb.failures, now)
+		if cb.conf.Window > 0 {
+			i := 0
+			for i < len(cb.failures) && now.Sub(cb.failures[i]) > cb.conf.Window {
+				i++
+			}
+			cb.failures = cb.failures[i:]
+		}
+		if len(cb.failures) >= cb.conf.Threshold {
+			cb.phase = circuitOpen
+			cb.failures = nil
+			return cb.conf.Cooldown
+		}
+	}
+
+	return cb.exp.Next(exit)
+}
+
+// isOpen reports whether the circuit is open, waiting out its cooldown.
+func (cb *circuitBreaker) isOpen() bool {
+	return cb.phase == circuitOpen
+}
+
+// beginRun is called as a run starts and returns the state to report for
+// it, moving an open circuit to half open for the trial run.
+func (cb *circuitBreaker) beginRun() State {
+	if cb.phase == circuitOpen {
+		cb.phase = circuitHalfOpen
+		return StateHalfOpen
+	}
+	return StateRunning
+}
@@ -0,0 +1,88 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Test the circuit breaker's open, half-open and closed transitions.
+func TestCircuitBreaker(t *testing.T) {
+	const cooldown = 30 * time.Millisecond
+	stable := 20 * time.Millisecond
+
+	var mu sync.Mutex
+	var waits []time.Duration
+	runs := 0
+	trial := make(chan struct{})
+
+	s := Start(context.Background(), Config{
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Millisecond,
+		Logger:     discardLogger,
+		Backoff: CircuitBreaker(CircuitBreakerConfig{
+			Threshold:       2,
+			Window:          time.Minute,
+			Cooldown:        cooldown,
+			StableThreshold: stable,
+		}),
+		After: func(d time.Duration) <-chan time.Time {
+			mu.Lock()
+			waits = append(waits, d)
+			mu.Unlock()
+			return time.After(d)
+		},
+	}, func(ctx context.Context) {
+		mu.Lock()
+		runs++
+		n := runs
+		mu.Unlock()
+
+		// Runs 1 and 2 trip the circuit, trial run 3 fails and reopens
+		// it, and trial run 4 stays up.
+		if n < 4 {
+			panic("boom")
+		}
+		close(trial)
+		<-ctx.Done()
+	})
+	defer s.Stop()
+
+	waitForState(t, s, StateCircuitOpen)
+
+	<-trial
+	if st := s.State(); st != StateHalfOpen {
+		t.Fatalf("expected trial run to be half open, got %v", st)
+	}
+	time.Sleep(stable)
+	waitForState(t, s, StateRunning)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	want := []time.Duration{time.Millisecond, cooldown, cooldown}
+	if !equalDurations(waits, want) {
+		t.Fatalf("expected waits %v, got %v", want, waits)
+	}
+}
+
+// Test that a circuit breaker without a Threshold opens after
+// DefaultCircuitThreshold failures rather than on the first.
+func TestCircuitBreakerDefaultThreshold(t *testing.T) {
+	for _, threshold := range []int{0, -1} {
+		cb := CircuitBreaker(CircuitBreakerConfig{Threshold: threshold, Cooldown: time.Minute}).(*circuitBreaker)
+		crash := ExitInfo{Reason: ExitPanic, Err: errors.New("boom")}
+
+		for i := 1; i < DefaultCircuitThreshold; i++ {
+			cb.Next(crash)
+			if cb.isOpen() {
+				t.Fatalf("Threshold %d: circuit opened after %d failures", threshold, i)
+			}
+		}
+		if d := cb.Next(crash); !cb.isOpen() || d != time.Minute {
+			t.Fatalf("Threshold %d: expected the circuit to open after %d failures, got a %v wait", threshold, DefaultCircuitThreshold, d)
+		}
+	}
+}
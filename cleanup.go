@@ -0,0 +1,60 @@
+package supervisor
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+type cleanupKey struct{}
+
+// cleanups are the functions registered with OnCleanup during one run.
+type cleanups struct {
+	mu   sync.Mutex
+	fns  []func()
+	done bool
+}
+
+// OnCleanup registers fn to be called when the run that ctx belongs to
+// ends, whether it returned or panicked, before the worker is restarted.
+// Cleanups run in reverse order of registration, like deferred calls, but
+// unlike defers they are registered with the supervisor and so run even if
+// the worker's own stack was unwound by a panic it did not expect.
+//
+// OnCleanup reports whether fn was registered. It does nothing and returns
+// false if ctx does not belong to a supervised run or the run has already
+// ended.
+func OnCleanup(ctx context.Context, fn func()) bool {
+	c, ok := ctx.Value(cleanupKey{}).(*cleanups)
+	if !ok {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.done {
+		return false
+	}
+	c.fns = append(c.fns, fn)
+	return true
+}
+
+// run calls the registered cleanups, last first. A cleanup that panics is
+// logged and the rest still run.
+func (c *cleanups) run(s *Supervisor) {
+	c.mu.Lock()
+	fns := c.fns
+	c.fns, c.done = nil, true
+	c.mu.Unlock()
+
+	for _, fn := range slices.Backward(fns) {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					s.logf("cleanup panicked: %s", s.cfg.FormatPanic(r))
+				}
+			}()
+			fn()
+		}()
+	}
+}
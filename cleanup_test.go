@@ -0,0 +1,50 @@
+package supervisor
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that cleanups run in reverse order after a panicking run, before
+// the restart, even if one of them panics.
+func TestOnCleanup(t *testing.T) {
+	var out syncBuffer
+	var order []string
+	runs := 0
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      log.New(&out, "", 0),
+	}, func(ctx context.Context) {
+		runs++
+		if runs == 2 {
+			order = append(order, "run 2")
+			return
+		}
+		OnCleanup(ctx, func() { order = append(order, "first") })
+		OnCleanup(ctx, func() { panic("cleanup boom") })
+		OnCleanup(ctx, func() { order = append(order, "last") })
+		panic("boom")
+	})
+	s.Wait()
+
+	want := []string{"last", "first", "run 2"}
+	if !slices.Equal(order, want) {
+		t.Fatalf("expected %v, got %v", want, order)
+	}
+	if !strings.Contains(out.String(), "[supervisor] cleanup panicked: cleanup boom") {
+		t.Fatalf("expected cleanup panic to be logged:\n%s", out.String())
+	}
+}
+
+// Test that OnCleanup is a no-op outside a supervised run.
+func TestOnCleanupUnsupervised(t *testing.T) {
+	if OnCleanup(context.Background(), func() {}) {
+		t.Fatal("expected OnCleanup to report false outside a supervised run")
+	}
+}
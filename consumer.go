@@ -0,0 +1,99 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ItemPanicAction selects what a consumer started by StartConsumer does
+// when handling an item panics.
+type ItemPanicAction int
+
+const (
+	// ItemSkip recovers the panic, logs it and moves on to the next item,
+	// so one bad item does not interrupt the consumer.
+	ItemSkip ItemPanicAction = iota
+
+	// ItemRestart lets the panic end the run, so the consumer is
+	// restarted with backoff like any crashed worker. The item is not
+	// retried.
+	ItemRestart
+)
+
+// ConsumerConfig configures a consumer started by StartConsumer.
+type ConsumerConfig struct {
+	// Config configures the supervisor of the consumption loop.
+	Config
+
+	// OnItemPanic selects what happens when handling an item panics. The
+	// default, ItemSkip, skips the item.
+	OnItemPanic ItemPanicAction
+}
+
+// A Consumer is the handle to a consumer started by StartConsumer. Its
+// embedded Supervisor supervises the consumption loop.
+type Consumer struct {
+	*Supervisor
+
+	processed atomic.Int64
+	panicked  atomic.Int64
+}
+
+// StartConsumer supervises a loop that receives items from in and calls
+// handle for each, until ctx is done or in is closed, at which point the
+// consumer stops. handle is passed the run's context, so it can use
+// helpers such as Heartbeat. A panic in handle is handled as
+// cfg.OnItemPanic says.
+func StartConsumer[T any](ctx context.Context, cfg ConsumerConfig, in <-chan T, handle func(ctx context.Context, item T)) *Consumer {
+	if handle == nil {
+		panic(nilWorkerPanic)
+	}
+	c := &Consumer{}
+	c.Supervisor = newSupervisor(ctx, cfg.Config, func(ctx context.Context) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case item, ok := <-in:
+				if !ok {
+					return errDrain
+				}
+				c.handle(ctx, cfg.OnItemPanic, func() { handle(ctx, item) })
+			}
+		}
+	})
+	go c.loop()
+	return c
+}
+
+// errDrain is returned by a worker that has finished for good, such as a
+// consumer whose channel was closed. The supervisor running it, which may
+// be a Clone, drains as if Drain had been called and the run returned.
+var errDrain = errors.New("supervisor: worker finished")
+
+// handle calls fn for one item and counts the outcome.
+func (c *Consumer) handle(ctx context.Context, action ItemPanicAction, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.panicked.Add(1)
+			if action == ItemRestart {
+				panic(r)
+			}
+			c.logf("item panicked, skipping it: %s", c.cfg.FormatPanic(r))
+		}
+	}()
+	fn()
+	c.processed.Add(1)
+}
+
+// Processed returns how many items have been handled without panicking.
+func (c *Consumer) Processed() int64 {
+	return c.processed.Load()
+}
+
+// Panicked returns how many items panicked while being handled, whether
+// they were skipped or restarted the consumer.
+func (c *Consumer) Panicked() int64 {
+	return c.panicked.Load()
+}
@@ -0,0 +1,86 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that a consumer skips items that panic by default, counts both
+// kinds, and stops once its channel is closed.
+func TestStartConsumerSkips(t *testing.T) {
+	in := make(chan int)
+	var handled []int
+
+	c := StartConsumer(context.Background(), ConsumerConfig{
+		Config: Config{Logger: discardLogger},
+	}, in, func(ctx context.Context, item int) {
+		if item%2 == 0 {
+			panic("even")
+		}
+		handled = append(handled, item)
+	})
+	for i := range 5 {
+		in <- i
+	}
+	close(in)
+	c.Wait()
+
+	if c.Processed() != 2 || c.Panicked() != 3 {
+		t.Fatalf("expected 2 processed and 3 panicked, got %d and %d", c.Processed(), c.Panicked())
+	}
+	if len(handled) != 2 || c.RestartCount() != 0 {
+		t.Fatalf("expected 2 items handled without restarts, got %v and %d restarts", handled, c.RestartCount())
+	}
+}
+
+// Test that ItemRestart restarts the consumer after an item panics and
+// carries on with the next item.
+func TestStartConsumerRestarts(t *testing.T) {
+	in := make(chan int)
+
+	c := StartConsumer(context.Background(), ConsumerConfig{
+		Config:      Config{MinBackoff: time.Millisecond, Logger: discardLogger},
+		OnItemPanic: ItemRestart,
+	}, in, func(ctx context.Context, item int) {
+		if item == 1 {
+			panic("boom")
+		}
+	})
+	for i := range 3 {
+		in <- i
+	}
+	close(in)
+	c.Wait()
+
+	if c.Processed() != 2 || c.Panicked() != 1 {
+		t.Fatalf("expected 2 processed and 1 panicked, got %d and %d", c.Processed(), c.Panicked())
+	}
+	if c.RestartCount() != 1 {
+		t.Fatalf("expected 1 restart, got %d", c.RestartCount())
+	}
+}
+
+// Test that closing the channel drains a clone of the consumer, not the
+// consumer it was cloned from.
+func TestStartConsumerClone(t *testing.T) {
+	in := make(chan int)
+
+	c := StartConsumer(context.Background(), ConsumerConfig{
+		Config: Config{MinBackoff: time.Millisecond, Logger: discardLogger},
+	}, in, func(ctx context.Context, item int) {})
+	c.Stop()
+	c.Wait()
+
+	clone := c.Clone(context.Background())
+	close(in)
+	select {
+	case <-clone.done:
+	case <-time.After(time.Second):
+		clone.Stop()
+		t.Fatal("the clone did not stop once the channel was closed")
+	}
+	if n := clone.RestartCount(); n != 0 || clone.StopReason() != StopDrained {
+		t.Fatalf("expected the clone to drain without restarts, got %d restarts and %v", n, clone.StopReason())
+	}
+}
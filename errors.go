@@ -0,0 +1,79 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Causes the supervisor cancels a run's context with. A worker can inspect
+// them with context.Cause to learn why it is being stopped.
+var (
+	// ErrIdle means the worker did not call Heartbeat within
+	// Config.IdleTimeout.
+	ErrIdle = errors.New("supervisor: worker idle")
+
+	// ErrRunTimeout means the run exceeded its deadline (see
+	// Config.RunTimeout and Config.RunDeadlineFunc).
+	ErrRunTimeout = errors.New("supervisor: run deadline exceeded")
+
+	// ErrResourceLimit means Config.ResourceProbe asked for a preventive
+	// restart.
+	ErrResourceLimit = errors.New("supervisor: resource limit reached")
+
+	// ErrMemoryLimit means Config.MemoryProbe reported more than
+	// Config.MemoryLimit.
+	ErrMemoryLimit = errors.New("supervisor: memory limit exceeded")
+
+	// ErrConfigChanged means Config.RestartSignal asked for a restart.
+	ErrConfigChanged = errors.New("supervisor: restart signalled")
+
+	// ErrWorkerReplaced means Supervisor.ReplaceWorker asked for a
+	// restart.
+	ErrWorkerReplaced = errors.New("supervisor: worker replaced")
+)
+
+// ErrStopped is returned by methods that wait for the supervisor to reach
+// some point when it stops before getting there.
+var ErrStopped = errors.New("supervisor: stopped")
+
+// ErrRestartRequested is the ExitInfo.Err of a run that returned after
+// calling RequestRestart.
+var ErrRestartRequested = errors.New("supervisor: restart requested by worker")
+
+// ErrGoexit is the ExitInfo.Err of a run whose worker called
+// runtime.Goexit, for example through testing.T.FailNow. Such a run is
+// treated as a failure and restarted like a crash.
+var ErrGoexit = errors.New("supervisor: worker called runtime.Goexit")
+
+// ErrAbandoned is the ExitInfo.Err of an idle run that did not return
+// within Config.AbandonTimeout and was presumed to have crashed.
+var ErrAbandoned = errors.New("supervisor: worker abandoned after not returning")
+
+// GaveUpError is the error a supervisor ends with when it gives up, either
+// because MaxRestarts or MaxTotalBackoff was exhausted or because of
+// FailFastOnFirstPanic.
+type GaveUpError struct {
+	// Restarts is the number of restarts counted against MaxRestarts.
+	Restarts int
+
+	// Last is the error the final run failed with, or nil if it returned
+	// cleanly.
+	Last error
+
+	// Panics are the formatted values of the panics leading up to the
+	// give-up, oldest first (see Supervisor.Panics).
+	Panics []string
+}
+
+func (e *GaveUpError) Error() string {
+	if e.Last == nil {
+		return fmt.Sprintf("supervisor: gave up after %d restarts", e.Restarts)
+	}
+	return fmt.Sprintf("supervisor: gave up after %d restarts: %v", e.Restarts, e.Last)
+}
+
+// Unwrap returns the last run's error, so errors.As can reach a
+// *PanicError.
+func (e *GaveUpError) Unwrap() error {
+	return e.Last
+}
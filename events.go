@@ -0,0 +1,62 @@
+package supervisor
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// event is one line written to Config.EventSink.
+type event struct {
+	TS               time.Time `json:"ts"`
+	Event            string    `json:"event"`
+	Name             string    `json:"name,omitempty"`
+	RunID            string    `json:"run_id"`
+	Attempt          int       `json:"attempt"`
+	BackoffMS        int64     `json:"backoff_ms,omitempty"`
+	Cause            string    `json:"cause,omitempty"`
+	Panic            string    `json:"panic,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	RestartLatencyMS int64     `json:"restart_latency_ms,omitempty"`
+}
+
+// eventMu serializes writes to event sinks, which are commonly shared
+// between supervisors and are not necessarily safe for concurrent use.
+var eventMu sync.Mutex
+
+// emit writes e to the event sink, if one is configured, filling in the
+// fields common to every event.
+func (s *Supervisor) emit(e event) {
+	if s.cfg.EventSink == nil {
+		return
+	}
+
+	e.TS = time.Now()
+	e.Name = s.cfg.Name
+	e.RunID = s.cfg.RunID
+	e.Attempt = s.currentAttempt()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	s.cfg.EventSink.Write(line)
+}
+
+// emitCrash emits a crash event for a run that ended with err.
+func (s *Supervisor) emitCrash(err error) {
+	e := event{Event: "crash"}
+
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		e.Panic = s.cfg.FormatPanic(pe.Value)
+	} else {
+		e.Error = err.Error()
+	}
+	s.emit(e)
+}
@@ -0,0 +1,56 @@
+package supervisor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that lifecycle events are written to EventSink as JSON lines.
+func TestSupervisorEventSink(t *testing.T) {
+	var sink syncBuffer
+
+	s := Start(context.Background(), Config{
+		RunID:       "events",
+		MinBackoff:  5 * time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      discardLogger,
+		EventSink:   &sink,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	var got []string
+	sc := bufio.NewScanner(strings.NewReader(sink.String()))
+	for sc.Scan() {
+		var e map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("invalid event line %q: %v", sc.Text(), err)
+		}
+		if e["run_id"] != "events" || e["ts"] == nil {
+			t.Fatalf("event missing common fields: %v", e)
+		}
+
+		name := e["event"].(string)
+		switch name {
+		case "crash":
+			if e["panic"] != "boom" {
+				t.Fatalf("crash event missing panic: %v", e)
+			}
+		case "restart":
+			if e["backoff_ms"] != 5.0 {
+				t.Fatalf("restart event missing backoff: %v", e)
+			}
+		}
+		got = append(got, name)
+	}
+
+	want := []string{"start", "crash", "restart", "start", "crash", "giveup", "stop"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+}
@@ -9,9 +9,10 @@ import (
 )
 
 func main() {
-	ctx := context.Background()
+	ctx, stop := supervisor.WithSignals(context.Background())
+	defer stop()
 
-	supervisor.Start(ctx, supervisor.DefaultConfig(), func(ctx context.Context) {
+	s := supervisor.Start(ctx, supervisor.DefaultConfig(), func(ctx context.Context) {
 		for {
 			select {
 			case <-ctx.Done():
@@ -30,5 +31,6 @@ func main() {
 		}
 	})
 
-	select {} // keep main alive
+	<-ctx.Done() // run until SIGINT or SIGTERM
+	s.Wait()
 }
@@ -0,0 +1,204 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ExitReason describes how the worker function itself ended a run.
+type ExitReason int
+
+const (
+	// ExitNone means there was no previous run.
+	ExitNone ExitReason = iota
+
+	// ExitClean means the worker returned (a nil error, for StartFunc).
+	// This includes returning because its context was cancelled.
+	ExitClean
+
+	// ExitPanic means the worker panicked.
+	ExitPanic
+
+	// ExitError means the worker returned a non-nil error (see StartFunc).
+	ExitError
+)
+
+func (r ExitReason) String() string {
+	switch r {
+	case ExitNone:
+		return "none"
+	case ExitClean:
+		return "clean"
+	case ExitPanic:
+		return "panic"
+	case ExitError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// RestartCause is a bounded classification of why the worker was
+// restarted, suitable as a metrics label. Its String values are stable.
+type RestartCause int
+
+const (
+	// CauseNone means no restart has been decided.
+	CauseNone RestartCause = iota
+
+	// CausePanic, CauseError and CauseCleanExit mean the run panicked,
+	// returned an error (see StartFunc), or returned cleanly.
+	CausePanic
+	CauseError
+	CauseCleanExit
+
+	// CauseHealthFail means the worker went idle (see Config.IdleTimeout).
+	CauseHealthFail
+
+	// CauseTimeout means the run exceeded its deadline (see
+	// Config.RunTimeout).
+	CauseTimeout
+
+	// CauseManual means the worker called RequestRestart, or
+	// Supervisor.ReplaceWorker restarted it.
+	CauseManual
+
+	// CauseConfigChange means Config.RestartSignal fired.
+	CauseConfigChange
+
+	// CauseResourceLimit means Config.ResourceProbe or Config.MemoryLimit
+	// asked for a preventive restart.
+	CauseResourceLimit
+)
+
+func (c RestartCause) String() string {
+	switch c {
+	case CauseNone:
+		return "none"
+	case CausePanic:
+		return "panic"
+	case CauseError:
+		return "error"
+	case CauseCleanExit:
+		return "clean-exit"
+	case CauseHealthFail:
+		return "health-fail"
+	case CauseTimeout:
+		return "timeout"
+	case CauseManual:
+		return "manual"
+	case CauseConfigChange:
+		return "config-change"
+	case CauseResourceLimit:
+		return "resource-limit"
+	default:
+		return "unknown"
+	}
+}
+
+// restartCauseOf classifies a run that ended with reason, where cause is
+// the supervisor's own reason for cancelling it, if any.
+func restartCauseOf(reason ExitReason, cause error) RestartCause {
+	switch cause {
+	case ErrIdle:
+		return CauseHealthFail
+	case ErrRunTimeout:
+		return CauseTimeout
+	case ErrRestartRequested, ErrWorkerReplaced:
+		return CauseManual
+	case ErrConfigChanged:
+		return CauseConfigChange
+	case ErrResourceLimit, ErrMemoryLimit:
+		return CauseResourceLimit
+	}
+	switch reason {
+	case ExitPanic:
+		return CausePanic
+	case ExitError:
+		return CauseError
+	default:
+		return CauseCleanExit
+	}
+}
+
+// ExitInfo describes a finished run.
+type ExitInfo struct {
+	// Attempt is the run's attempt number, starting at 1.
+	Attempt int
+
+	// Reason is how the worker function ended.
+	Reason ExitReason
+
+	// Err is the error the run failed with: a *PanicError, the error the
+	// worker or Config.OnStart returned, or the cause the supervisor
+	// cancelled the run with (such as ErrIdle). It is nil for a clean run.
+	Err error
+
+	// Duration is how long the run lasted.
+	Duration time.Duration
+}
+
+// Failed reports whether the run failed rather than returning cleanly.
+func (e ExitInfo) Failed() bool {
+	return e.Err != nil
+}
+
+// Attempt describes one run of the worker, as passed to Observer methods.
+// Fields describing how the run ended are zero until it has, and
+// NextBackoff until a restart has been decided. Each call gets its own
+// copy, which the observer may keep.
+type Attempt struct {
+	// Number is the attempt number, starting at 1.
+	Number int
+
+	StartedAt time.Time
+	EndedAt   time.Time
+
+	// RestartLatency is the wall-clock gap between the end of the previous
+	// run and the start of this one, including backoff, RestartGate,
+	// LoadGate and SetMaxConcurrentRestarts waits, and any time spent in
+	// StateIdle. It is zero for the first run.
+	RestartLatency time.Duration
+
+	// ExitReason is how the worker function ended.
+	ExitReason ExitReason
+
+	// Err is the error the run failed with, as in ExitInfo.
+	Err error
+
+	// PanicValue and Stack are set if the run panicked. Stack is only
+	// captured with Config.CaptureStack.
+	PanicValue any
+	Stack      []byte
+
+	// NextBackoff is the wait before the restart that follows the run.
+	NextBackoff time.Duration
+
+	// Cause is why the run is being restarted, once that is decided.
+	Cause RestartCause
+}
+
+// exitReasonOf classifies the error a run ended with.
+func exitReasonOf(err error) ExitReason {
+	var pe *PanicError
+	switch {
+	case err == nil:
+		return ExitClean
+	case errors.As(err, &pe):
+		return ExitPanic
+	default:
+		return ExitError
+	}
+}
+
+type lastExitKey struct{}
+
+// LastExitReason reports how the previous run of the worker ended, given
+// the context passed to the current run. It is ExitNone on the first run.
+// A worker can use it to do extra recovery, such as rolling back a partial
+// transaction, only after a crash.
+func LastExitReason(ctx context.Context) ExitReason {
+	r, _ := ctx.Value(lastExitKey{}).(ExitReason)
+	return r
+}
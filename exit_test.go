@@ -0,0 +1,114 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Test that each run sees how the previous run ended.
+func TestLastExitReason(t *testing.T) {
+	var seen []ExitReason
+	runs := 0
+
+	s := StartFunc(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 3,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) error {
+		seen = append(seen, LastExitReason(ctx))
+		runs++
+		switch runs {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("failed")
+		}
+		return nil
+	})
+	s.Wait()
+
+	want := []ExitReason{ExitNone, ExitPanic, ExitError, ExitClean}
+	if len(seen) != len(want) {
+		t.Fatalf("expected %v, got %v", want, seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, seen)
+		}
+	}
+}
+
+// Test that LastExitReason is ExitNone outside a supervised run.
+func TestLastExitReasonOutsideSupervisor(t *testing.T) {
+	if r := LastExitReason(context.Background()); r != ExitNone {
+		t.Fatalf("expected ExitNone, got %v", r)
+	}
+}
+
+// Test that restarts are tagged with the cause of the run's end.
+func TestRestartCause(t *testing.T) {
+	rec := NewRecorder()
+	runs := 0
+
+	Run(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		MaxRestarts: 3,
+		RunTimeout:  20 * time.Millisecond,
+		Logger:      discardLogger,
+		Observer:    rec,
+	}, func(ctx context.Context) {
+		runs++
+		switch runs {
+		case 1:
+			panic("boom")
+		case 2:
+			RequestRestart(ctx)
+		case 3:
+			<-ctx.Done()
+		}
+	})
+
+	var got []RestartCause
+	for _, r := range rec.Events() {
+		if r.Kind == RecordRestart {
+			got = append(got, r.Attempt.Cause)
+		}
+	}
+	want := []RestartCause{CausePanic, CauseManual, CauseTimeout, CauseCleanExit}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected causes %v, got %v", want, got)
+	}
+}
+
+// Test that each restarted run records the gap since the previous run
+// ended, including its backoff.
+func TestRestartLatency(t *testing.T) {
+	rec := NewRecorder()
+
+	Run(context.Background(), Config{
+		MinBackoff:  20 * time.Millisecond,
+		MaxBackoff:  20 * time.Millisecond,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+		Observer:    rec,
+	}, func(ctx context.Context) { panic("boom") })
+
+	var got []time.Duration
+	for _, r := range rec.Events() {
+		if r.Kind == RecordStart {
+			got = append(got, r.Attempt.RestartLatency)
+		}
+	}
+	if len(got) != 3 || got[0] != 0 {
+		t.Fatalf("expected no latency for the first of 3 runs, got %v", got)
+	}
+	for _, d := range got[1:] {
+		if d < 20*time.Millisecond {
+			t.Fatalf("expected restart latencies of at least the backoff, got %v", got)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// GroupConfig configures a group of workers started by StartGroup.
+type GroupConfig struct {
+	// Config is applied to every worker in the group.
+	Config
+
+	// StaggerStart spreads the workers' first runs over this window by
+	// giving each worker a random InitialDelay in [0, StaggerStart). This
+	// avoids a thundering herd when many workers start at once. Zero
+	// starts every worker after the configured InitialDelay.
+	StaggerStart time.Duration
+
+	// MaxGroupRestarts is a restart budget shared by the whole group. If
+	// the workers together restart more than this many times within
+	// GroupRestartWindow, which usually means a systemic failure, every
+	// worker is stopped and the group enters StateGaveUp. Zero means no
+	// group budget; per-worker MaxRestarts still applies.
+	MaxGroupRestarts int
+
+	// GroupRestartWindow is the sliding window MaxGroupRestarts is counted
+	// over. Zero counts restarts over the group's whole lifetime.
+	GroupRestartWindow time.Duration
+
+	// MaxConcurrentHooks bounds how many hooks, such as OnRestart, run at
+	// once across the whole group, so that a mass restart does not flood
+	// whatever the hooks call. Further hooks queue for a slot; a hook
+	// still queued when HookTimeout elapses, or when its supervisor is
+	// stopped, is skipped. Zero means no limit.
+	MaxConcurrentHooks int
+
+	// RateLimit, if positive, is a rate in tokens per second shared by the
+	// whole group: workers call WaitToken before each rate-limited
+	// operation, and the group's limiter makes them wait their turn.
+	// RateBurst is how many tokens may be taken at once after a quiet
+	// period; it is at least 1.
+	RateLimit float64
+	RateBurst int
+
+	// OnGroupGiveUp is called once when the group exceeds its restart
+	// budget or an essential worker gives up, before its workers are
+	// stopped.
+	OnGroupGiveUp func()
+}
+
+// Group is a handle to a set of supervised workers started together.
+// Each worker is supervised independently.
+type Group struct {
+	cfg         GroupConfig
+	ctx         context.Context
+	cancel      context.CancelFunc
+	supervisors []*Supervisor
+
+	mu       sync.Mutex
+	restarts []time.Time
+	gaveUp   bool
+	arrived  []bool        // which workers have reached the barrier
+	waiting  int           // workers yet to reach the barrier
+	barrier  chan struct{} // closed once every worker has reached it
+}
+
+// WorkerSpec describes one worker of a group started by StartGroupWorkers,
+// with the settings that may differ from the rest of the group.
+type WorkerSpec struct {
+	// Worker is the function to supervise, as passed to Start.
+	Worker func(ctx context.Context)
+
+	// Logger overrides the group's Logger for this worker, for example to
+	// send each tenant's logs to its own destination. Nil uses the
+	// group's.
+	Logger *log.Logger
+
+	// Essential marks a worker the group cannot do without: if it gives
+	// up, every worker in the group is stopped and the group enters
+	// StateGaveUp. A non-essential worker that gives up just stops, and
+	// the rest of the group carries on without it.
+	Essential bool
+}
+
+// StartGroup starts a supervisor for each worker using cfg.
+//
+// Cancelling ctx or calling Stop stops every worker in the group.
+func StartGroup(ctx context.Context, cfg GroupConfig, workers ...func(ctx context.Context)) *Group {
+	specs := make([]WorkerSpec, len(workers))
+	for i, worker := range workers {
+		specs[i] = WorkerSpec{Worker: worker}
+	}
+	return StartGroupWorkers(ctx, cfg, specs...)
+}
+
+// StartGroupWorkers is like StartGroup, but each worker is described by a
+// WorkerSpec that can override parts of cfg for that worker.
+func StartGroupWorkers(ctx context.Context, cfg GroupConfig, workers ...WorkerSpec) *Group {
+	g := &Group{
+		cfg:     cfg,
+		arrived: make([]bool, len(workers)),
+		waiting: len(workers),
+		barrier: make(chan struct{}),
+	}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+
+	var hookSlots chan struct{}
+	if cfg.MaxConcurrentHooks > 0 {
+		hookSlots = make(chan struct{}, cfg.MaxConcurrentHooks)
+	}
+	var tokens *tokenBucket
+	if cfg.RateLimit > 0 {
+		tokens = newTokenBucket(cfg.RateLimit, cfg.RateBurst)
+	}
+
+	for i, spec := range workers {
+		wcfg := cfg.Config
+		if cfg.StaggerStart > 0 {
+			wcfg.InitialDelay = time.Duration(rand.Int64N(int64(cfg.StaggerStart)))
+		}
+		if spec.Logger != nil {
+			wcfg.Logger = spec.Logger
+		}
+
+		s := newSupervisor(g.ctx, wcfg, errorless(spec.Worker))
+		if cfg.MaxGroupRestarts > 0 {
+			s.onRestart = g.recordRestart
+		}
+		s.hookSlots = hookSlots
+		s.tokens = tokens
+		if spec.Essential {
+			s.onGiveUp = g.essentialGaveUp
+		}
+		s.barrier = func(ctx context.Context) error { return g.awaitBarrier(ctx, i) }
+		g.supervisors = append(g.supervisors, s)
+	}
+
+	for _, s := range g.supervisors {
+		go s.loop()
+	}
+
+	return g
+}
+
+// recordRestart counts a worker restart against the group budget and
+// tears the group down if it has been exceeded.
+func (g *Group) recordRestart() {
+	now := time.Now()
+
+	g.mu.Lock()
+	if g.gaveUp {
+		g.mu.Unlock()
+		return
+	}
+
+	g.restarts = append(g.restarts, now)
+	if w := g.cfg.GroupRestartWindow; w > 0 {
+		i := 0
+		for i < len(g.restarts) && now.Sub(g.restarts[i]) > w {
+			i++
+		}
+		g.restarts = g.restarts[i:]
+	}
+
+	if len(g.restarts) <= g.cfg.MaxGroupRestarts {
+		g.mu.Unlock()
+		return
+	}
+	g.gaveUp = true
+	n := len(g.restarts)
+	g.mu.Unlock()
+
+	g.logf("group giving up after %d restarts", n)
+
+	if g.cfg.OnGroupGiveUp != nil {
+		g.cfg.OnGroupGiveUp()
+	}
+	g.cancel()
+}
+
+type barrierKey struct{}
+
+// Barrier blocks the worker running with ctx until every worker in its
+// group has called Barrier, so that, for example, no worker starts
+// consuming until all of them have connected. It returns ctx's error if
+// ctx is done first, and nil otherwise.
+//
+// The barrier opens once, for the group's start: after that Barrier
+// returns immediately, including in restarted runs. A worker that calls
+// it again before the barrier opens, in a later run, is only counted
+// once. If some worker never calls Barrier, for instance because it gave
+// up first, the barrier never opens. Barrier returns nil immediately if
+// ctx does not belong to a run of a group's worker.
+func Barrier(ctx context.Context) error {
+	wait, ok := ctx.Value(barrierKey{}).(func(context.Context) error)
+	if !ok {
+		return nil
+	}
+	return wait(ctx)
+}
+
+// awaitBarrier records that worker i has reached the barrier and waits for
+// the rest.
+func (g *Group) awaitBarrier(ctx context.Context, i int) error {
+	g.mu.Lock()
+	if !g.arrived[i] {
+		g.arrived[i] = true
+		g.waiting--
+		if g.waiting == 0 {
+			close(g.barrier)
+		}
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-g.barrier:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// essentialGaveUp tears the group down after an essential worker gave up.
+func (g *Group) essentialGaveUp() {
+	g.mu.Lock()
+	if g.gaveUp {
+		g.mu.Unlock()
+		return
+	}
+	g.gaveUp = true
+	g.mu.Unlock()
+
+	g.logf("essential worker gave up, stopping group")
+	if g.cfg.OnGroupGiveUp != nil {
+		g.cfg.OnGroupGiveUp()
+	}
+	g.cancel()
+}
+
+func (g *Group) logf(format string, args ...any) {
+	logger := g.cfg.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("[supervisor] "+format, args...)
+}
+
+// Supervisors returns the supervisors of the group's workers, in the order
+// the workers were passed to StartGroup or StartGroupWorkers.
+func (g *Group) Supervisors() []*Supervisor {
+	return append([]*Supervisor(nil), g.supervisors...)
+}
+
+// State reports StateGaveUp if the group exceeded its restart budget or
+// lost an essential worker, StateStopped once it has been stopped, and
+// StateRunning otherwise.
+func (g *Group) State() State {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	switch {
+	case g.gaveUp:
+		return StateGaveUp
+	case g.ctx.Err() != nil:
+		return StateStopped
+	default:
+		return StateRunning
+	}
+}
+
+// Stop stops every worker in the group. It does not wait for them to
+// return; use Wait for that.
+func (g *Group) Stop() {
+	g.cancel()
+}
+
+// Wait blocks until every supervisor in the group has stopped. It returns
+// the *GaveUpError of each worker that gave up, joined with errors.Join in
+// the order the workers were passed in, or nil if none did.
+func (g *Group) Wait() error {
+	var errs []error
+	for _, s := range g.supervisors {
+		s.Wait()
+		if gu, ok := s.Err().(*GaveUpError); ok {
+			errs = append(errs, gu)
+		}
+	}
+	return errors.Join(errs...)
+}
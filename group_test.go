@@ -0,0 +1,353 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that every worker in a group runs and the group stops together.
+func TestGroupRunsAllWorkers(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(3)
+
+	worker := func(ctx context.Context) {
+		wg.Done()
+		<-ctx.Done()
+	}
+
+	g := StartGroup(context.Background(), GroupConfig{
+		Config: Config{Logger: discardLogger},
+	}, worker, worker, worker)
+
+	started := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(started)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("not every worker started")
+	}
+
+	g.Stop()
+	g.Wait()
+}
+
+// Test that no worker passes Barrier until every worker has reached it,
+// and that it stays open for restarted runs.
+func TestGroupBarrier(t *testing.T) {
+	var passed atomic.Int32
+	release := make(chan struct{})
+	restarted := make(chan struct{})
+
+	early := func(ctx context.Context) {
+		if Barrier(ctx) == nil {
+			passed.Add(1)
+		}
+		<-ctx.Done()
+	}
+	runs := 0
+	late := func(ctx context.Context) {
+		runs++
+		if runs == 1 {
+			<-release
+		}
+		if Barrier(ctx) == nil {
+			passed.Add(1)
+		}
+		if runs == 1 {
+			panic("boom")
+		}
+		close(restarted)
+		<-ctx.Done()
+	}
+
+	g := StartGroup(context.Background(), GroupConfig{
+		Config: Config{MinBackoff: time.Millisecond, Logger: discardLogger},
+	}, early, early, late)
+	defer g.Wait()
+	defer g.Stop()
+
+	time.Sleep(20 * time.Millisecond)
+	if n := passed.Load(); n != 0 {
+		t.Fatalf("expected no worker past the barrier yet, got %d", n)
+	}
+	close(release)
+
+	select {
+	case <-restarted:
+	case <-time.After(time.Second):
+		t.Fatal("restarted worker blocked on the barrier")
+	}
+	if n := passed.Load(); n != 4 {
+		t.Fatalf("expected 4 passes, got %d", n)
+	}
+	if err := Barrier(context.Background()); err != nil {
+		t.Fatalf("expected Barrier outside a group to return nil, got %v", err)
+	}
+}
+
+// Test that the workers of a group share its rate limit.
+func TestGroupRateLimit(t *testing.T) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	worker := func(ctx context.Context) {
+		for range 5 {
+			if err := WaitToken(ctx); err != nil {
+				t.Error(err)
+			}
+		}
+		wg.Done()
+		<-ctx.Done()
+	}
+
+	begin := time.Now()
+	g := StartGroup(context.Background(), GroupConfig{
+		Config:    Config{Logger: discardLogger},
+		RateLimit: 100,
+	}, worker, worker)
+	wg.Wait()
+	elapsed := time.Since(begin)
+	g.Stop()
+	g.Wait()
+
+	// The first token is free and the other 9 come at 10ms intervals.
+	if elapsed < 80*time.Millisecond {
+		t.Fatalf("expected 10 tokens to take about 90ms together, took %v", elapsed)
+	}
+	if err := WaitToken(context.Background()); err != nil {
+		t.Fatalf("expected WaitToken outside a group to return nil, got %v", err)
+	}
+}
+
+// Test that StaggerStart spreads first runs within the window.
+func TestGroupStaggerStart(t *testing.T) {
+	const n = 5
+	stagger := 100 * time.Millisecond
+
+	var mu sync.Mutex
+	var starts []time.Duration
+	begin := time.Now()
+
+	worker := func(ctx context.Context) {
+		mu.Lock()
+		starts = append(starts, time.Since(begin))
+		mu.Unlock()
+		<-ctx.Done()
+	}
+
+	workers := make([]func(ctx context.Context), n)
+	for i := range workers {
+		workers[i] = worker
+	}
+
+	g := StartGroup(context.Background(), GroupConfig{
+		Config:       Config{Logger: discardLogger},
+		StaggerStart: stagger,
+	}, workers...)
+
+	time.Sleep(stagger + 50*time.Millisecond)
+	g.Stop()
+	g.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(starts) != n {
+		t.Fatalf("expected %d workers to start, got %d", n, len(starts))
+	}
+	for _, d := range starts {
+		if d > stagger+50*time.Millisecond {
+			t.Fatalf("worker started after %v, outside stagger window %v", d, stagger)
+		}
+	}
+}
+
+// Test that the group gives up once its shared restart budget is exceeded.
+func TestGroupRestartBudget(t *testing.T) {
+	gaveUp := make(chan struct{})
+
+	crasher := func(ctx context.Context) {
+		panic("boom")
+	}
+	healthy := func(ctx context.Context) {
+		<-ctx.Done()
+	}
+
+	g := StartGroup(context.Background(), GroupConfig{
+		Config: Config{
+			MinBackoff: time.Millisecond,
+			MaxBackoff: time.Millisecond,
+			Logger:     discardLogger,
+		},
+		MaxGroupRestarts:   5,
+		GroupRestartWindow: time.Minute,
+		OnGroupGiveUp:      func() { close(gaveUp) },
+	}, crasher, crasher, healthy)
+
+	select {
+	case <-gaveUp:
+	case <-time.After(time.Second):
+		t.Fatal("group did not give up")
+	}
+
+	g.Wait()
+
+	if st := g.State(); st != StateGaveUp {
+		t.Fatalf("expected group state %v, got %v", StateGaveUp, st)
+	}
+}
+
+// Test that a per-worker Logger overrides the group's, and a nil one falls
+// back to it.
+func TestGroupWorkerLogger(t *testing.T) {
+	var group, tenant syncBuffer
+
+	worker := func(ctx context.Context) {
+		<-ctx.Done()
+	}
+
+	g := StartGroupWorkers(context.Background(), GroupConfig{
+		Config: Config{Logger: log.New(&group, "", 0)},
+	},
+		WorkerSpec{Worker: worker},
+		WorkerSpec{Worker: worker, Logger: log.New(&tenant, "", 0)},
+	)
+	g.Stop()
+	g.Wait()
+
+	if n := strings.Count(group.String(), "[supervisor] stopped"); n != 1 {
+		t.Fatalf("expected one stop logged to the group logger, got %d:\n%s", n, group.String())
+	}
+	if n := strings.Count(tenant.String(), "[supervisor] stopped"); n != 1 {
+		t.Fatalf("expected one stop logged to the worker logger, got %d:\n%s", n, tenant.String())
+	}
+}
+
+// Test that Group.Wait joins the give-up errors of the workers that gave
+// up and ignores cleanly stopped ones.
+func TestGroupWaitErrors(t *testing.T) {
+	crash := func(ctx context.Context) {
+		panic("boom")
+	}
+	block := func(ctx context.Context) {
+		<-ctx.Done()
+	}
+
+	g := StartGroup(context.Background(), GroupConfig{
+		Config: Config{MinBackoff: time.Millisecond, MaxRestarts: 1, Logger: discardLogger},
+	}, crash, block, crash)
+
+	sups := g.Supervisors()
+	sups[0].Wait()
+	sups[2].Wait()
+	g.Stop()
+
+	err := g.Wait()
+	var gu *GaveUpError
+	if !errors.As(err, &gu) {
+		t.Fatalf("expected a *GaveUpError, got %v", err)
+	}
+	if n := len(err.(interface{ Unwrap() []error }).Unwrap()); n != 2 {
+		t.Fatalf("expected 2 give-ups, got %d: %v", n, err)
+	}
+
+	g = StartGroup(context.Background(), GroupConfig{
+		Config: Config{Logger: discardLogger},
+	}, block)
+	g.Stop()
+	if err := g.Wait(); err != nil {
+		t.Fatalf("expected nil for a cleanly stopped group, got %v", err)
+	}
+}
+
+// Test that MaxConcurrentHooks bounds hooks running at once across the
+// group without dropping any.
+func TestGroupMaxConcurrentHooks(t *testing.T) {
+	var mu sync.Mutex
+	running, peak, calls := 0, 0, 0
+
+	crash := func(ctx context.Context) {
+		panic("boom")
+	}
+
+	g := StartGroup(context.Background(), GroupConfig{
+		Config: Config{
+			MinBackoff:  time.Millisecond,
+			MaxRestarts: 1,
+			Logger:      discardLogger,
+			OnRestart: func(ctx context.Context, attempt int, backoff time.Duration) {
+				mu.Lock()
+				running++
+				calls++
+				peak = max(peak, running)
+				mu.Unlock()
+
+				time.Sleep(10 * time.Millisecond)
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+			},
+		},
+		MaxConcurrentHooks: 2,
+	}, crash, crash, crash, crash, crash)
+	g.Wait()
+
+	if peak > 2 {
+		t.Fatalf("expected at most 2 hooks at once, saw %d", peak)
+	}
+	if calls != 5 {
+		t.Fatalf("expected all 5 hooks to run, got %d", calls)
+	}
+}
+
+// Test that only an essential worker giving up stops the whole group.
+func TestGroupEssentialWorker(t *testing.T) {
+	cfg := GroupConfig{
+		Config: Config{MinBackoff: time.Millisecond, MaxRestarts: 1, Logger: discardLogger},
+	}
+	crash := func(ctx context.Context) {
+		panic("boom")
+	}
+	block := func(ctx context.Context) {
+		<-ctx.Done()
+	}
+
+	g := StartGroupWorkers(context.Background(), cfg,
+		WorkerSpec{Worker: crash},
+		WorkerSpec{Worker: block},
+	)
+	g.Supervisors()[0].Wait()
+	time.Sleep(10 * time.Millisecond)
+	if st := g.State(); st != StateRunning {
+		t.Fatalf("expected a best-effort give-up to leave the group running, got %v", st)
+	}
+	g.Stop()
+	g.Wait()
+
+	g = StartGroupWorkers(context.Background(), cfg,
+		WorkerSpec{Worker: crash, Essential: true},
+		WorkerSpec{Worker: block},
+	)
+	done := make(chan struct{})
+	go func() {
+		g.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("essential give-up did not stop the group")
+	}
+	if st := g.State(); st != StateGaveUp {
+		t.Fatalf("expected StateGaveUp, got %v", st)
+	}
+}
@@ -0,0 +1,166 @@
+package supervisor
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IdleAction selects what happens to a worker that exceeds IdleTimeout.
+type IdleAction int
+
+const (
+	// IdleRestart cancels the idle run and restarts it with backoff, as if
+	// it had crashed.
+	IdleRestart IdleAction = iota
+
+	// IdleStop cancels the idle run and leaves the supervisor in StateIdle
+	// until Resume is called, so on-demand workers can scale to zero.
+	IdleStop
+)
+
+type heartbeatKey struct{}
+
+// Heartbeat reports that the worker running with ctx is still active. It
+// never blocks and does nothing if ctx does not belong to a supervised run.
+func Heartbeat(ctx context.Context) {
+	beat, ok := ctx.Value(heartbeatKey{}).(chan struct{})
+	if !ok {
+		return
+	}
+	select {
+	case beat <- struct{}{}:
+	default:
+	}
+}
+
+type restartKey struct{}
+
+// RequestRestart asks the supervisor to restart the worker running with
+// ctx as soon as the current run returns, whatever the restart policy.
+// Call it and then return, for a clean restart out of a bad internal state
+// without panicking. The restart has no backoff, does not grow the
+// backoff and does not count against MaxRestarts. A run that panics or
+// returns an error after requesting a restart is treated as a failure as
+// usual. It does nothing if ctx does not belong to a supervised run.
+func RequestRestart(ctx context.Context) {
+	if requested, ok := ctx.Value(restartKey{}).(*atomic.Bool); ok {
+		requested.Store(true)
+	}
+}
+
+type sectionsKey struct{}
+
+// Uninterruptible runs fn, a unit of work that must not be cut short, to
+// completion, unless ctx is already done, in which case it returns ctx's
+// error without running fn. A worker can wrap each unit in it so that,
+// once shutdown is requested, no new unit starts while one in progress is
+// always finished.
+//
+// fn is not given a context, so nothing cancels it; the supervisor always
+// waits for the current run to return before it reports being stopped.
+// While a unit is in progress, the run is also not cancelled for being
+// idle (see IdleTimeout) or abandoned (see AbandonTimeout), for up to
+// Config.MaxUninterruptible.
+func Uninterruptible(ctx context.Context, fn func()) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if active, ok := ctx.Value(sectionsKey{}).(*sections); ok {
+		active.enter()
+		defer active.leave()
+	}
+	fn()
+	return nil
+}
+
+// sections counts the Uninterruptible units in progress in one run.
+type sections struct {
+	mu    sync.Mutex
+	n     int
+	clear chan struct{} // closed once n is back to zero
+}
+
+func newSections() *sections {
+	clear := make(chan struct{})
+	close(clear)
+	return &sections{clear: clear}
+}
+
+func (a *sections) enter() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.n == 0 {
+		a.clear = make(chan struct{})
+	}
+	a.n++
+}
+
+func (a *sections) leave() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.n--
+	if a.n == 0 {
+		close(a.clear)
+	}
+}
+
+// waitSections waits, if a unit of a is in progress, for it to finish and
+// reports true, or reports false once MaxUninterruptible elapses or stop
+// is closed first. It reports false at once if no unit is in progress.
+func (s *Supervisor) waitSections(a *sections, stop <-chan struct{}) bool {
+	a.mu.Lock()
+	clear := a.clear
+	a.mu.Unlock()
+
+	select {
+	case <-clear:
+		return false
+	default:
+	}
+	limit := s.cfg.MaxUninterruptible
+	if limit == 0 {
+		limit = time.Minute
+	}
+	select {
+	case <-clear:
+		return true
+	case <-s.cfg.After(limit):
+		s.logf("uninterruptible section still running after %v", limit)
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+type shutdownGraceKey struct{}
+
+// ShutdownContext returns a context for the worker running with ctx to use
+// while it shuts down. It carries ctx's values but is not cancelled with
+// it: it is only cancelled Config.ShutdownGrace after ctx is done, so a
+// worker can still make a final network call once its run is cancelled.
+// It returns ctx itself if ShutdownGrace is zero or ctx does not belong to
+// a supervised run.
+func ShutdownContext(ctx context.Context) context.Context {
+	grace, ok := ctx.Value(shutdownGraceKey{}).(time.Duration)
+	if !ok {
+		return ctx
+	}
+	shutdown, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	context.AfterFunc(ctx, func() { time.AfterFunc(grace, cancel) })
+	return shutdown
+}
+
+type readyKey struct{}
+
+// Ready reports that the worker running with ctx has finished initializing.
+// It releases a StartSync caller waiting on the first run, delivers nil on
+// Supervisor.FirstError, and releases the run's slot under
+// SetMaxConcurrentRestarts if it still holds one (see Config.StartWindow).
+// It does nothing if ctx does not belong to a supervised run.
+func Ready(ctx context.Context) {
+	if ready, ok := ctx.Value(readyKey{}).(func()); ok {
+		ready()
+	}
+}
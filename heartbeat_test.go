@@ -0,0 +1,256 @@
+package supervisor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForState polls s until it reaches want or the timeout elapses.
+func waitForState(t *testing.T, s *Supervisor, want State) {
+	t.Helper()
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for s.State() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected state %v, got %v", want, s.State())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Test that IdleStop stops a silent worker until Resume is called.
+func TestSupervisorIdleStopAndResume(t *testing.T) {
+	runs := make(chan struct{}, 10)
+
+	s := Start(context.Background(), Config{
+		Logger:      discardLogger,
+		IdleTimeout: 20 * time.Millisecond,
+		IdleAction:  IdleStop,
+	}, func(ctx context.Context) {
+		runs <- struct{}{}
+		<-ctx.Done()
+	})
+	defer s.Stop()
+
+	<-runs
+	waitForState(t, s, StateIdle)
+
+	if len(runs) != 0 {
+		t.Fatal("idle worker was restarted without Resume")
+	}
+
+	s.Resume()
+
+	select {
+	case <-runs:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("worker did not run after Resume")
+	}
+}
+
+// Test that heartbeats keep a worker from being considered idle.
+func TestSupervisorHeartbeatKeepsWorkerAlive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := make(chan struct{}, 10)
+
+	Start(ctx, Config{
+		Logger:      discardLogger,
+		IdleTimeout: 20 * time.Millisecond,
+	}, func(ctx context.Context) {
+		runs <- struct{}{}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+				Heartbeat(ctx)
+			}
+		}
+	})
+
+	<-runs
+	time.Sleep(100 * time.Millisecond)
+
+	if len(runs) != 0 {
+		t.Fatal("heartbeating worker was restarted as idle")
+	}
+}
+
+// Test that AbandonTimeout gives up on an idle run that never returns and
+// restarts the worker.
+func TestSupervisorAbandonTimeout(t *testing.T) {
+	stuck := make(chan struct{})
+	defer close(stuck)
+	rec := NewRecorder()
+	runs := make(chan int, 10)
+	var n atomic.Int32
+
+	s := Start(context.Background(), Config{
+		MinBackoff:     time.Millisecond,
+		IdleTimeout:    20 * time.Millisecond,
+		AbandonTimeout: 20 * time.Millisecond,
+		Logger:         discardLogger,
+		Observer:       rec,
+	}, func(ctx context.Context) {
+		run := int(n.Add(1))
+		runs <- run
+		if run == 1 {
+			<-stuck // ignores ctx, like a hung cgo call
+			return
+		}
+		<-ctx.Done()
+	})
+	defer s.Stop()
+
+	<-runs
+	select {
+	case <-runs:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("the hung run was not abandoned")
+	}
+	if exit := rec.Events()[1]; exit.Kind != RecordExit || exit.Attempt.Err != ErrAbandoned {
+		t.Fatalf("expected the first run to exit with ErrAbandoned, got %+v", exit)
+	}
+}
+
+// Test that Heartbeat is a no-op outside a supervised run.
+func TestHeartbeatOutsideSupervisor(t *testing.T) {
+	Heartbeat(context.Background())
+}
+
+// Test that RequestRestart restarts a clean run despite the policy, without
+// backoff or using up the restart budget.
+func TestRequestRestart(t *testing.T) {
+	rec := NewRecorder()
+	runs := 0
+
+	err := Run(context.Background(), Config{
+		MinBackoff:    time.Hour,
+		MaxBackoff:    time.Hour,
+		RestartPolicy: RestartNever,
+		MaxRestarts:   1,
+		Logger:        discardLogger,
+		Observer:      rec,
+	}, func(ctx context.Context) {
+		runs++
+		if runs < 3 {
+			RequestRestart(ctx)
+		}
+	})
+
+	if err != nil || runs != 3 {
+		t.Fatalf("expected 3 runs ending cleanly, got %d runs and %v", runs, err)
+	}
+	if a := rec.Events()[1].Attempt; a.Err != ErrRestartRequested {
+		t.Fatalf("expected the first exit to be ErrRestartRequested, got %v", a.Err)
+	}
+}
+
+// Test that an Uninterruptible unit in progress finishes after Stop, and
+// that no new unit starts afterwards.
+func TestUninterruptible(t *testing.T) {
+	started := make(chan struct{})
+	units := 0
+	var skipped error
+
+	s := Start(context.Background(), Config{Logger: discardLogger}, func(ctx context.Context) {
+		Uninterruptible(ctx, func() {
+			close(started)
+			<-ctx.Done()
+			time.Sleep(10 * time.Millisecond)
+			units++
+		})
+		skipped = Uninterruptible(ctx, func() { units++ })
+	})
+
+	<-started
+	s.Stop()
+	s.Wait()
+
+	if units != 1 {
+		t.Fatalf("expected the in-progress unit alone to complete, got %d units", units)
+	}
+	if skipped != context.Canceled {
+		t.Fatalf("expected the next unit to be refused with context.Canceled, got %v", skipped)
+	}
+}
+
+// Test that ShutdownContext outlives the run's context by ShutdownGrace.
+func TestShutdownContext(t *testing.T) {
+	started := make(chan struct{})
+	var afterStop, afterGrace error
+
+	s := Start(context.Background(), Config{
+		ShutdownGrace: 20 * time.Millisecond,
+		Logger:        discardLogger,
+	}, func(ctx context.Context) {
+		shutdown := ShutdownContext(ctx)
+		close(started)
+		<-ctx.Done()
+		afterStop = shutdown.Err()
+		<-shutdown.Done()
+		afterGrace = shutdown.Err()
+	})
+
+	<-started
+	begin := time.Now()
+	s.Stop()
+	s.Wait()
+
+	if afterStop != nil {
+		t.Fatalf("expected the shutdown context to be live after Stop, got %v", afterStop)
+	}
+	if afterGrace == nil || time.Since(begin) < 20*time.Millisecond {
+		t.Fatalf("expected the shutdown context to end after the grace period, got %v", afterGrace)
+	}
+	if ctx := context.Background(); ShutdownContext(ctx) != ctx {
+		t.Fatal("expected ShutdownContext outside a run to return ctx")
+	}
+}
+
+// Test that an Uninterruptible unit longer than IdleTimeout and
+// AbandonTimeout finishes, and that MaxUninterruptible still bounds one
+// that never does.
+func TestUninterruptibleHoldsOffWatchdogs(t *testing.T) {
+	rec := NewRecorder()
+	var finished atomic.Bool
+
+	Run(context.Background(), Config{
+		RestartPolicy:  RestartNever,
+		IdleTimeout:    20 * time.Millisecond,
+		AbandonTimeout: 20 * time.Millisecond,
+		Logger:         discardLogger,
+		Observer:       rec,
+	}, func(ctx context.Context) {
+		Uninterruptible(ctx, func() {
+			time.Sleep(100 * time.Millisecond)
+			finished.Store(true)
+		})
+	})
+
+	if exit := rec.Events()[1]; !finished.Load() || exit.Attempt.Err != nil {
+		t.Fatalf("expected the unit to finish and the run to end cleanly, got %+v", exit.Attempt)
+	}
+
+	stuck := make(chan struct{})
+	defer close(stuck)
+	rec = NewRecorder()
+	Run(context.Background(), Config{
+		RestartPolicy:      RestartNever,
+		IdleTimeout:        20 * time.Millisecond,
+		AbandonTimeout:     20 * time.Millisecond,
+		MaxUninterruptible: 20 * time.Millisecond,
+		Logger:             discardLogger,
+		Observer:           rec,
+	}, func(ctx context.Context) {
+		Uninterruptible(ctx, func() { <-stuck })
+	})
+
+	if exit := rec.Events()[1]; exit.Attempt.Err != ErrAbandoned {
+		t.Fatalf("expected a unit past MaxUninterruptible to be abandoned, got %+v", exit.Attempt)
+	}
+}
@@ -0,0 +1,482 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that OnRestart receives the attempt and backoff.
+func TestSupervisorOnRestart(t *testing.T) {
+	type call struct {
+		attempt int
+		backoff time.Duration
+	}
+	calls := make(chan call, 10)
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+		OnRestart: func(ctx context.Context, attempt int, backoff time.Duration) {
+			calls <- call{attempt, backoff}
+		},
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+	close(calls)
+
+	var got []call
+	for c := range calls {
+		got = append(got, c)
+	}
+	want := []call{{1, time.Millisecond}, {2, 2 * time.Millisecond}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("expected OnRestart calls %v, got %v", want, got)
+	}
+}
+
+// Test that a hung hook is abandoned after HookTimeout.
+func TestSupervisorHookTimeout(t *testing.T) {
+	var out syncBuffer
+	hookCtxDone := make(chan struct{})
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		HookTimeout: 20 * time.Millisecond,
+		Logger:      log.New(&out, "", 0),
+		OnRestart: func(ctx context.Context, attempt int, backoff time.Duration) {
+			<-ctx.Done()
+			close(hookCtxDone)
+			select {} // hang regardless of the context
+		},
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("hung hook stalled the supervisor")
+	}
+
+	<-hookCtxDone
+	if !strings.Contains(out.String(), "[supervisor] hook timed out") {
+		t.Fatalf("expected hook timeout log:\n%s", out.String())
+	}
+}
+
+// orderWriter records which log lines were written, in order, alongside
+// other events appended by a test.
+type orderWriter struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (w *orderWriter) add(ev string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.events = append(w.events, ev)
+}
+
+func (w *orderWriter) Write(p []byte) (int, error) {
+	if strings.Contains(string(p), "[supervisor] stopped") {
+		w.add("stopped")
+	}
+	return len(p), nil
+}
+
+// Test that "stopped" and OnStop come only after the worker has finished
+// its shutdown work.
+func TestSupervisorStopAfterWorkerReturns(t *testing.T) {
+	var order orderWriter
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+
+	s := Start(ctx, Config{
+		Logger: log.New(&order, "", 0),
+		OnStop: func() { order.add("onstop") },
+	}, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond) // flush
+		order.add("flushed")
+	})
+
+	<-started
+	cancel()
+	s.Wait()
+
+	want := []string{"flushed", "stopped", "onstop"}
+	if !slices.Equal(order.events, want) {
+		t.Fatalf("expected %v, got %v", want, order.events)
+	}
+}
+
+// Test that Flush is called after everything else and before Wait
+// returns.
+func TestSupervisorFlush(t *testing.T) {
+	var order orderWriter
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := Start(ctx, Config{
+		Logger: log.New(&order, "", 0),
+		OnStop: func() { order.add("onstop") },
+		Flush:  func() { order.add("flush") },
+	}, func(ctx context.Context) {})
+	s.Wait()
+
+	want := []string{"stopped", "onstop", "flush"}
+	if !slices.Equal(order.events, want) {
+		t.Fatalf("expected %v, got %v", want, order.events)
+	}
+}
+
+// Test that SyncRestartLog flushes after logging a restart, before backing
+// off, and logs when the backoff is over.
+func TestSupervisorSyncRestartLog(t *testing.T) {
+	var out syncBuffer
+	runs := 0
+
+	Run(context.Background(), Config{
+		MinBackoff:     20 * time.Millisecond,
+		MaxRestarts:    1,
+		Logger:         log.New(&out, "", 0),
+		SyncRestartLog: true,
+		Flush:          func() { out.Write([]byte("flush\n")) },
+	}, func(ctx context.Context) {
+		runs++
+		if runs == 1 {
+			panic("boom")
+		}
+	})
+
+	var got []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		for _, want := range []string{"restarting worker in", "flush", "relaunching worker after", "stopped"} {
+			if strings.HasPrefix(strings.TrimPrefix(line, "[supervisor] "), want) {
+				got = append(got, want)
+			}
+		}
+	}
+	want := []string{"restarting worker in", "flush", "relaunching worker after", "stopped", "flush"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %q, got %q:\n%s", want, got, out.String())
+	}
+}
+
+// orderObserver is a Recorder that also notes its starts and exits in a
+// shared order, for tests that interleave them with other callbacks.
+type orderObserver struct {
+	*Recorder
+	order *[]string
+}
+
+func (o orderObserver) OnStart(ctx context.Context, a *Attempt) {
+	*o.order = append(*o.order, fmt.Sprintf("observer start %d", a.Number))
+	o.Recorder.OnStart(ctx, a)
+}
+
+func (o orderObserver) OnExit(a *Attempt) {
+	*o.order = append(*o.order, fmt.Sprintf("observer exit %d", a.Number))
+	o.Recorder.OnExit(a)
+}
+
+// Test that OnStart returns before observers are told of the start and
+// before the worker runs, and that an OnStart error skips both and fails
+// the attempt with backoff.
+func TestSupervisorOnStart(t *testing.T) {
+	errSetup := errors.New("setup failed")
+	rec := NewRecorder()
+	var order []string
+
+	Run(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+		Observer:    orderObserver{Recorder: rec, order: &order},
+		OnStart: func(ctx context.Context, attempt int) error {
+			time.Sleep(5 * time.Millisecond)
+			order = append(order, fmt.Sprintf("onstart %d", attempt))
+			if attempt == 2 {
+				return errSetup
+			}
+			return nil
+		},
+	}, func(ctx context.Context) {
+		order = append(order, "worker")
+		panic("boom")
+	})
+
+	want := []string{
+		"onstart 1", "observer start 1", "worker", "observer exit 1",
+		"onstart 2", "observer exit 2",
+		"onstart 3", "observer start 3", "worker", "observer exit 3",
+	}
+	if !slices.Equal(order, want) {
+		t.Fatalf("expected %q, got %q", want, order)
+	}
+	var restarts []*Attempt
+	for _, r := range rec.Events() {
+		if r.Kind == RecordRestart {
+			restarts = append(restarts, r.Attempt)
+		}
+	}
+	if len(restarts) != 2 || restarts[1].Err != errSetup || restarts[1].NextBackoff != 2*time.Millisecond {
+		t.Fatalf("expected attempt 2 to fail with the OnStart error and back off, got %+v", restarts)
+	}
+}
+
+// Test that a panic in the supervisor goroutine, here from a hook, is
+// logged and still runs OnStop and Flush, for both kinds of supervisor and
+// for hooks run in a goroutine of their own under HookTimeout.
+func TestSupervisorInternalPanic(t *testing.T) {
+	var pool Pool
+	starts := map[string]func(ctx context.Context, cfg Config, worker func(ctx context.Context)) *Supervisor{
+		"Start": Start,
+		"Pool":  pool.Start,
+		"HookTimeout": func(ctx context.Context, cfg Config, worker func(ctx context.Context)) *Supervisor {
+			cfg.HookTimeout = time.Second
+			return Start(ctx, cfg, worker)
+		},
+	}
+	for name, start := range starts {
+		t.Run(name, func(t *testing.T) {
+			var out syncBuffer
+			var stopped, flushed atomic.Bool
+
+			s := start(context.Background(), Config{
+				MinBackoff: time.Millisecond,
+				Logger:     log.New(&out, "", 0),
+				OnRestart:  func(context.Context, int, time.Duration) { panic("hook bug") },
+				OnStop:     func() { stopped.Store(true) },
+				Flush:      func() { flushed.Store(true) },
+			}, func(ctx context.Context) { panic("boom") })
+			s.Wait()
+
+			if !stopped.Load() || !flushed.Load() {
+				t.Fatalf("expected OnStop and Flush to run, got %v and %v", stopped.Load(), flushed.Load())
+			}
+			if !strings.Contains(out.String(), "[supervisor] internal panic: hook bug") {
+				t.Fatalf("expected the internal panic to be logged:\n%s", out.String())
+			}
+			if pe, ok := s.Err().(*PanicError); !ok || pe.Value != "hook bug" || s.StopReason() != StopFatal {
+				t.Fatalf("expected a fatal stop with the hook's panic, got %v and %v", s.Err(), s.StopReason())
+			}
+		})
+	}
+}
+
+// Test that panics in OnStop and Flush, which run after the loop has
+// ended, are recovered too: later observers still see the stop, and Err
+// reports the panic.
+func TestSupervisorStopHookPanics(t *testing.T) {
+	var pool Pool
+	starts := map[string]func(ctx context.Context, cfg Config, worker func(ctx context.Context)) *Supervisor{
+		"Start": Start,
+		"Pool":  pool.Start,
+	}
+	for name, start := range starts {
+		t.Run(name, func(t *testing.T) {
+			rec := NewRecorder()
+
+			s := start(context.Background(), Config{
+				RestartPolicy: RestartNever,
+				Logger:        discardLogger,
+				OnStop:        func() { panic("stop bug") },
+				Flush:         func() { panic("flush bug") },
+				Observer:      rec,
+			}, func(ctx context.Context) {})
+			s.Wait()
+
+			if rec.Count(RecordStop) != 1 {
+				t.Fatal("expected the observer to see the stop")
+			}
+			if pe, ok := s.Err().(*PanicError); !ok || pe.Value != "flush bug" {
+				t.Fatalf("expected Err to report the Flush panic, got %v", s.Err())
+			}
+		})
+	}
+}
+
+// Test that the supervisor waits for work hooks start with Async before
+// reporting that it stopped.
+func TestSupervisorWaitsForAsyncHooks(t *testing.T) {
+	var order orderWriter
+	started := make(chan bool, 1)
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      log.New(&order, "", 0),
+		OnRestart: func(ctx context.Context, attempt int, backoff time.Duration) {
+			started <- Async(ctx, func() {
+				time.Sleep(30 * time.Millisecond)
+				order.add("async")
+			})
+		},
+		OnStop: func() { order.add("onstop") },
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	if !<-started {
+		t.Fatal("Async did not start the work")
+	}
+	want := []string{"async", "stopped", "onstop"}
+	if !slices.Equal(order.events, want) {
+		t.Fatalf("expected %v, got %v", want, order.events)
+	}
+	if Async(context.Background(), func() {}) {
+		t.Fatal("Async started work outside a hook")
+	}
+}
+
+// Test that RespectDeadlineGrace lets the current run outlive the parent's
+// deadline by the grace period, without restarting it.
+func TestSupervisorRespectDeadlineGrace(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	runs := 0
+	var ran time.Duration
+
+	start := time.Now()
+	s := Start(ctx, Config{
+		MinBackoff:           time.Millisecond,
+		RespectDeadlineGrace: 50 * time.Millisecond,
+		Logger:               discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		<-ctx.Done()
+		ran = time.Since(start)
+	})
+	s.Wait()
+
+	if runs != 1 {
+		t.Fatalf("expected 1 run, got %d", runs)
+	}
+	if ran < 70*time.Millisecond {
+		t.Fatalf("expected the run to last past the deadline plus grace, got %v", ran)
+	}
+}
+
+// recordingObserver records the lifecycle calls it receives.
+type recordingObserver struct {
+	NopObserver
+	calls []string
+}
+
+func (r *recordingObserver) OnStart(ctx context.Context, a *Attempt) {
+	r.calls = append(r.calls, fmt.Sprintf("start %d", a.Number))
+}
+
+func (r *recordingObserver) OnExit(a *Attempt) {
+	r.calls = append(r.calls, fmt.Sprintf("exit %v %v", a.ExitReason, a.PanicValue))
+}
+
+func (r *recordingObserver) OnPanic(err *PanicError) {
+	r.calls = append(r.calls, fmt.Sprintf("panic %v", err.Value))
+}
+
+func (r *recordingObserver) OnRestart(ctx context.Context, a *Attempt) {
+	r.calls = append(r.calls, fmt.Sprintf("restart %d after %v", a.Number, a.NextBackoff))
+}
+
+func (r *recordingObserver) OnGiveUp(lastErr any) {
+	r.calls = append(r.calls, fmt.Sprintf("giveup %v", lastErr))
+}
+
+func (r *recordingObserver) OnStop() {
+	r.calls = append(r.calls, "stop")
+}
+
+// Test that an Observer sees every lifecycle point in order, alongside the
+// hook fields.
+func TestSupervisorObserver(t *testing.T) {
+	obs := &recordingObserver{}
+	var hookStops int
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      discardLogger,
+		Observer:    obs,
+		OnStop:      func() { hookStops++ },
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	want := []string{
+		"start 1", "panic boom", "exit panic boom", "restart 1 after 1ms",
+		"start 2", "panic boom", "exit panic boom", "giveup boom",
+		"stop",
+	}
+	if !slices.Equal(obs.calls, want) {
+		t.Fatalf("expected %q, got %q", want, obs.calls)
+	}
+	if hookStops != 1 {
+		t.Fatalf("expected OnStop hook to still be called once, got %d", hookStops)
+	}
+}
+
+type tenantKey struct{}
+
+// Test that BaseContext values reach the worker and hooks, while the
+// context passed to Start still controls the supervisor.
+func TestSupervisorBaseContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := make(chan any, 4)
+
+	s := Start(ctx, Config{
+		MinBackoff: time.Millisecond,
+		Logger:     discardLogger,
+		BaseContext: func() context.Context {
+			return context.WithValue(context.Background(), tenantKey{}, "acme")
+		},
+		OnRestart: func(ctx context.Context, attempt int, backoff time.Duration) {
+			seen <- ctx.Value(tenantKey{})
+		},
+	}, func(ctx context.Context) {
+		seen <- ctx.Value(tenantKey{})
+		if LastExitReason(ctx) == ExitNone {
+			panic("boom")
+		}
+		<-ctx.Done()
+	})
+
+	for i := 0; i < 3; i++ {
+		if v := <-seen; v != "acme" {
+			t.Fatalf("expected the tenant from BaseContext, got %v", v)
+		}
+	}
+
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cancelling Start's context did not stop the supervisor")
+	}
+}
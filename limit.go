@@ -0,0 +1,138 @@
+package supervisor
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// runSlots is the process-wide limit set by SetMaxConcurrentRestarts.
+var runSlots = &slotLimiter{freed: make(chan struct{})}
+
+// slotLimiter is a counting semaphore whose size can change while
+// supervisors hold or wait for slots.
+type slotLimiter struct {
+	mu    sync.Mutex
+	max   int // no limit if zero or less
+	inUse int
+	freed chan struct{} // closed and replaced whenever a slot may be free
+}
+
+// SetMaxConcurrentRestarts limits how many supervisors in the process may
+// be starting their worker at once, so that many supervisors recovering
+// from a shared outage do not all restart together. Before each run, a
+// supervisor over the limit waits for a slot, or until it is stopped or
+// drained. The run gives the slot back as soon as the worker function is
+// entered or, with Config.StartWindow, once the worker calls Ready, the
+// window elapses or the run ends, whichever is first. Runs started while
+// there is no limit do not count against one set later. A limit of zero
+// or less, the default, removes the limit.
+func SetMaxConcurrentRestarts(n int) {
+	runSlots.mu.Lock()
+	defer runSlots.mu.Unlock()
+	runSlots.max = n
+	runSlots.wakeLocked()
+}
+
+// acquire waits for a slot, reporting false if stop or drain is closed
+// first. The returned release may be called more than once.
+func (l *slotLimiter) acquire(stop, drain <-chan struct{}) (release func(), ok bool) {
+	for {
+		l.mu.Lock()
+		if l.max <= 0 {
+			l.mu.Unlock()
+			return func() {}, true
+		}
+		if l.inUse < l.max {
+			l.inUse++
+			l.mu.Unlock()
+			return sync.OnceFunc(l.release), true
+		}
+		freed := l.freed
+		l.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-stop:
+			return nil, false
+		case <-drain:
+			return nil, false
+		}
+	}
+}
+
+func (l *slotLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inUse--
+	l.wakeLocked()
+}
+
+// wakeLocked wakes everyone waiting for a slot to check again.
+func (l *slotLimiter) wakeLocked() {
+	close(l.freed)
+	l.freed = make(chan struct{})
+}
+
+type tokenKey struct{}
+
+// WaitToken blocks the worker running with ctx until the rate limiter of
+// its group, set up by GroupConfig.RateLimit, grants it a token, so that
+// every worker of the group shares one rate towards, say, an external API.
+// It returns ctx's error if ctx is done first, in which case no token is
+// used. It returns nil immediately if the group has no rate limit or ctx
+// does not belong to a run of a group's worker.
+func WaitToken(ctx context.Context) error {
+	b, ok := ctx.Value(tokenKey{}).(*tokenBucket)
+	if !ok {
+		return nil
+	}
+	return b.wait(ctx)
+}
+
+// tokenBucket is a token bucket rate limiter: it holds up to burst tokens
+// and gains rate of them per second.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64 // negative when waiters have reserved future tokens
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// wait reserves a token and waits until it is due.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		b.tokens++
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
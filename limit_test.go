@@ -0,0 +1,98 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// slotsInUse returns how many SetMaxConcurrentRestarts slots are held.
+func slotsInUse() int {
+	runSlots.mu.Lock()
+	defer runSlots.mu.Unlock()
+	return runSlots.inUse
+}
+
+// Test that SetMaxConcurrentRestarts holds a run back until another one
+// calls Ready within its StartWindow, and that a waiting supervisor can
+// still be stopped.
+func TestSetMaxConcurrentRestarts(t *testing.T) {
+	if n := slotsInUse(); n != 0 {
+		t.Fatalf("expected no slots in use before the test, got %d", n)
+	}
+	SetMaxConcurrentRestarts(1)
+	defer SetMaxConcurrentRestarts(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ready := make(chan struct{})
+	started := make(chan int, 3)
+	worker := func(n int) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			started <- n
+			if n == 1 {
+				<-ready
+				Ready(ctx)
+			}
+			<-ctx.Done()
+		}
+	}
+
+	cfg := Config{StartWindow: time.Hour, Logger: discardLogger}
+	Start(ctx, cfg, worker(1))
+	if n := <-started; n != 1 {
+		t.Fatalf("expected worker 1 to start, got %d", n)
+	}
+	Start(ctx, cfg, worker(2))
+	waiting := Start(ctx, cfg, worker(3))
+
+	select {
+	case n := <-started:
+		t.Fatalf("worker %d started while the only slot was held", n)
+	case <-time.After(30 * time.Millisecond):
+	}
+
+	waiting.Stop()
+	waiting.Wait()
+	close(ready)
+	select {
+	case n := <-started:
+		if n != 2 {
+			t.Fatalf("expected worker 2 to start, got %d", n)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("worker 2 did not start after Ready released the slot")
+	}
+}
+
+// Test that without StartWindow a run frees its slot once the worker is
+// entered, so that long-lived workers do not cap how many can run, and
+// that runs started without a limit do not count against a later one.
+func TestSetMaxConcurrentRestartsFreesSlotOnStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	started := make(chan struct{}, 3)
+	worker := func(ctx context.Context) {
+		started <- struct{}{}
+		<-ctx.Done()
+	}
+
+	Start(ctx, Config{Logger: discardLogger}, worker)
+	<-started
+	SetMaxConcurrentRestarts(1)
+	defer SetMaxConcurrentRestarts(0)
+
+	for range 2 {
+		Start(ctx, Config{Logger: discardLogger}, worker)
+		select {
+		case <-started:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("a long-lived worker kept its slot")
+		}
+	}
+	if n := slotsInUse(); n != 0 {
+		t.Fatalf("expected no slots held by running workers, got %d", n)
+	}
+}
@@ -0,0 +1,97 @@
+package supervisor
+
+import "context"
+
+// An Observer is notified at each point of a supervised worker's
+// lifecycle. It is an alternative to setting the individual hook fields of
+// Config for code that wants to observe everything in one type; embed
+// NopObserver to implement only some of the methods.
+//
+// Calls are made in lifecycle order and are bounded by HookTimeout like
+// the hook fields. With a HookTimeout each call runs on a goroutine of its
+// own, which is left running if it overruns, so calls can overlap: an
+// Observer used with HookTimeout must be safe for concurrent use.
+type Observer interface {
+	// OnStart is called as each run begins, once Config.OnStart, if set,
+	// has succeeded.
+	OnStart(ctx context.Context, a *Attempt)
+
+	// OnExit is called after each run with how it ended.
+	OnExit(a *Attempt)
+
+	// OnPanic is called after a run panicked, before OnExit.
+	OnPanic(err *PanicError)
+
+	// OnRestart is called like Config.OnRestart, with the attempt that
+	// just ended and its NextBackoff and Cause set.
+	OnRestart(ctx context.Context, a *Attempt)
+
+	// OnStop is called like Config.OnStop.
+	OnStop()
+
+	// OnGiveUp is called like Config.OnGiveUp.
+	OnGiveUp(lastErr any)
+}
+
+// NopObserver implements Observer with methods that do nothing.
+type NopObserver struct{}
+
+func (NopObserver) OnStart(context.Context, *Attempt)   {}
+func (NopObserver) OnExit(*Attempt)                     {}
+func (NopObserver) OnPanic(*PanicError)                 {}
+func (NopObserver) OnRestart(context.Context, *Attempt) {}
+func (NopObserver) OnStop()                             {}
+func (NopObserver) OnGiveUp(any)                        {}
+
+// hookObserver adapts Config's hook fields to Observer.
+type hookObserver struct {
+	NopObserver
+	cfg *Config
+}
+
+func (h hookObserver) OnRestart(ctx context.Context, a *Attempt) {
+	if h.cfg.OnRestart != nil {
+		h.cfg.OnRestart(ctx, a.Number, a.NextBackoff)
+	}
+}
+
+func (h hookObserver) OnStop() {
+	if h.cfg.OnStop != nil {
+		h.cfg.OnStop()
+	}
+}
+
+func (h hookObserver) OnGiveUp(lastErr any) {
+	if h.cfg.OnGiveUp != nil {
+		h.cfg.OnGiveUp(lastErr)
+	}
+}
+
+// observersFor returns the observers a supervisor with cfg notifies: the
+// hook fields, if any are set, followed by cfg.Observer.
+func observersFor(cfg *Config) []Observer {
+	var obs []Observer
+	if cfg.OnRestart != nil || cfg.OnStop != nil || cfg.OnGiveUp != nil {
+		obs = append(obs, hookObserver{cfg: cfg})
+	}
+	if cfg.Observer != nil {
+		obs = append(obs, cfg.Observer)
+	}
+	return obs
+}
+
+// observe calls fn for each observer through callHook.
+func (s *Supervisor) observe(fn func(ctx context.Context, o Observer)) {
+	for _, o := range s.observers {
+		s.callHook(func(ctx context.Context) { fn(ctx, o) })
+	}
+}
+
+// observeAttempt is observe for methods that take an Attempt, giving each
+// observer its own copy of a.
+func (s *Supervisor) observeAttempt(a Attempt, fn func(ctx context.Context, o Observer, a *Attempt)) {
+	s.observe(func(ctx context.Context, o Observer) {
+		a := a
+		fn(ctx, o, &a)
+	})
+}
@@ -0,0 +1,93 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+)
+
+// PanicError is the error a supervised run ends with when it panics.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+
+	// Stack is the stack trace at the point of the panic, if captured.
+	Stack []byte
+
+	// Duration is how long the worker had been running when it panicked,
+	// from the call to the worker function to the recovery. It is zero for
+	// panics recovered by Recovering.
+	Duration time.Duration
+
+	// format is the supervisor's Config.FormatPanic, if any.
+	format func(v any) string
+}
+
+func (e *PanicError) Error() string {
+	format := e.format
+	if format == nil {
+		format = formatPanic
+	}
+	return "panic: " + format(e.Value)
+}
+
+// Unwrap returns the panic value if it is an error, so that errors.Is and
+// errors.As see through a panic to the chain of errors it carried.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// formatPanic is the default Config.FormatPanic. Errors are rendered with
+// %+v, which includes the extra detail, such as a stack trace, that some
+// error packages add.
+func formatPanic(v any) string {
+	if err, ok := v.(error); ok {
+		return fmt.Sprintf("%+v", err)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// safeFormat wraps a Config.FormatPanic so that a panic in it falls back
+// to formatPanic. It is often called while recovering from another panic,
+// on a goroutine with nothing left above it to recover.
+func safeFormat(format func(v any) string) func(v any) string {
+	return func(v any) (s string) {
+		defer func() {
+			if recover() != nil {
+				s = formatPanic(v)
+			}
+		}()
+		return format(v)
+	}
+}
+
+// Recovering wraps fn so that a panic inside it is recovered and returned
+// as a *PanicError (with its stack) instead of unwinding the goroutine.
+// Use it with StartFunc to have the restart policy see every failure as
+// an error.
+func Recovering(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}()
+		return fn(ctx)
+	}
+}
+
+// giveUpValue returns what OnGiveUp receives for a run that ended with
+// err: the panic value for panics, otherwise err itself.
+func giveUpValue(err error) any {
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		return pe.Value
+	}
+	if err == nil {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,346 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Test that Recovering converts a panic into a *PanicError.
+func TestRecoveringReturnsPanicError(t *testing.T) {
+	fn := Recovering(func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	err := fn(context.Background())
+
+	var pe *PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected *PanicError, got %v", err)
+	}
+	if pe.Value != "boom" {
+		t.Fatalf("expected panic value %q, got %v", "boom", pe.Value)
+	}
+	if len(pe.Stack) == 0 {
+		t.Fatal("expected a captured stack")
+	}
+	if err.Error() != "panic: boom" {
+		t.Fatalf("unexpected error text %q", err.Error())
+	}
+}
+
+// detailedError renders extra detail under %+v, like pkg/errors does.
+type detailedError struct{ err error }
+
+func (e detailedError) Error() string { return e.err.Error() }
+func (e detailedError) Unwrap() error { return e.err }
+
+func (e detailedError) Format(f fmt.State, verb rune) {
+	io.WriteString(f, e.Error())
+	if f.Flag('+') {
+		io.WriteString(f, " [detail]")
+	}
+}
+
+// Test that a panic with an error keeps its chain for errors.Is and logs
+// it with %+v.
+func TestPanicErrorChain(t *testing.T) {
+	errDB := errors.New("db down")
+	var out syncBuffer
+
+	s := Start(context.Background(), Config{
+		MaxRestarts: 1,
+		MinBackoff:  time.Millisecond,
+		Logger:      log.New(&out, "", 0),
+	}, func(ctx context.Context) {
+		panic(detailedError{fmt.Errorf("query: %w", errDB)})
+	})
+	s.Wait()
+
+	if !errors.Is(s.Err(), errDB) {
+		t.Fatalf("expected errors.Is to reach the panic's chain, got %v", s.Err())
+	}
+	if !strings.Contains(out.String(), "worker crashed: query: db down [detail]") {
+		t.Fatalf("expected the crash log to use %%+v:\n%s", out.String())
+	}
+}
+
+// Test that Recovering passes through ordinary results.
+func TestRecoveringPassesThrough(t *testing.T) {
+	want := errors.New("failed")
+
+	if err := Recovering(func(ctx context.Context) error { return want })(context.Background()); err != want {
+		t.Fatalf("expected %v, got %v", want, err)
+	}
+	if err := Recovering(func(ctx context.Context) error { return nil })(context.Background()); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+}
+
+// Test that StartFunc restarts on errors and reports them to OnGiveUp.
+func TestStartFuncRestartsOnError(t *testing.T) {
+	want := errors.New("failed")
+	gaveUp := make(chan any, 1)
+	runs := 0
+
+	s := StartFunc(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		Logger:      discardLogger,
+		MaxRestarts: 1,
+		OnGiveUp:    func(lastErr any) { gaveUp <- lastErr },
+	}, Recovering(func(ctx context.Context) error {
+		runs++
+		if runs == 1 {
+			panic("boom")
+		}
+		return want
+	}))
+
+	s.Wait()
+
+	if runs != 2 {
+		t.Fatalf("expected 2 runs, got %d", runs)
+	}
+	if v := <-gaveUp; v != want {
+		t.Fatalf("expected OnGiveUp to receive %v, got %v", want, v)
+	}
+}
+
+// Test that FormatPanic is used for crash logs and PanicError text.
+func TestSupervisorFormatPanic(t *testing.T) {
+	var out syncBuffer
+	runs := 0
+
+	s := StartFunc(context.Background(), Config{
+		Logger:      log.New(&out, "", 0),
+		MaxRestarts: 1,
+		MinBackoff:  time.Millisecond,
+		FormatPanic: func(v any) string { return fmt.Sprintf("<%v>", v) },
+	}, func(ctx context.Context) error {
+		runs++
+		if runs == 1 {
+			panic("outer")
+		}
+		return Recovering(func(ctx context.Context) error { panic("inner") })(ctx)
+	})
+	s.Wait()
+
+	logs := out.String()
+	for _, want := range []string{"worker crashed: <outer>", "worker failed: panic: <inner>"} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs missing %q:\n%s", want, logs)
+		}
+	}
+}
+
+// Test that a panic records how long the worker ran, and that
+// LogRunDuration logs it.
+func TestSupervisorLogRunDuration(t *testing.T) {
+	var out syncBuffer
+	rec := NewRecorder()
+
+	Run(context.Background(), Config{
+		Logger:         log.New(&out, "", 0),
+		MaxRestarts:    1,
+		MinBackoff:     time.Millisecond,
+		LogRunDuration: true,
+		Observer:       rec,
+	}, func(ctx context.Context) {
+		time.Sleep(30 * time.Millisecond)
+		panic("boom")
+	})
+
+	if rec.Count(RecordPanic) == 0 {
+		t.Fatal("expected the worker to panic")
+	}
+	for _, r := range rec.Events() {
+		if r.Kind == RecordPanic && r.Panic.Duration < 30*time.Millisecond {
+			t.Fatalf("expected the panic to record at least 30ms, got %v", r.Panic.Duration)
+		}
+	}
+	if !regexp.MustCompile(`worker crashed after \d+ms: boom`).MatchString(out.String()) {
+		t.Fatalf("expected the crash log to include the run duration:\n%s", out.String())
+	}
+}
+
+// Test that the panics leading to a give-up are kept, in order, on the
+// handle and in the GaveUpError.
+func TestSupervisorPanicHistory(t *testing.T) {
+	runs := 0
+
+	err := Run(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		panic(fmt.Sprintf("boom %d", runs))
+	})
+
+	want := []string{"boom 1", "boom 2", "boom 3"}
+	var gu *GaveUpError
+	if !errors.As(err, &gu) {
+		t.Fatalf("expected a *GaveUpError, got %v", err)
+	}
+	if !slices.Equal(gu.Panics, want) {
+		t.Fatalf("expected panics %q, got %q", want, gu.Panics)
+	}
+}
+
+// Test that only the most recent panics are retained.
+func TestSupervisorPanicHistoryBounded(t *testing.T) {
+	runs := 0
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Microsecond,
+		MaxBackoff:  time.Microsecond,
+		MaxRestarts: maxPanicHistory + 4,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		panic(runs)
+	})
+	s.Wait()
+
+	got := s.Panics()
+	if len(got) != maxPanicHistory {
+		t.Fatalf("expected %d panics, got %d", maxPanicHistory, len(got))
+	}
+	if last := got[len(got)-1]; last != fmt.Sprint(runs) {
+		t.Fatalf("expected the latest panic %d last, got %s", runs, last)
+	}
+}
+
+// Test that a FormatPanic that panics while the panic history is being
+// recorded stops the supervisor rather than deadlocking it.
+func TestSupervisorFormatPanicPanicsInHistory(t *testing.T) {
+	var calls atomic.Int32
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      discardLogger,
+		// The first call formats the crash log; the second the history.
+		FormatPanic: func(v any) string {
+			if calls.Add(1) == 2 {
+				panic("formatter")
+			}
+			return fmt.Sprint(v)
+		},
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+
+	select {
+	case <-s.done:
+	case <-time.After(time.Second):
+		t.Fatal("supervisor deadlocked")
+	}
+}
+
+// Test that a FormatPanic that panics falls back to the default format
+// wherever it is used, rather than crashing the process.
+func TestSupervisorFormatPanicPanics(t *testing.T) {
+	var out syncBuffer
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      log.New(&out, "", 0),
+		FormatPanic: func(v any) string { panic("formatter") },
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	if !strings.Contains(out.String(), "worker crashed: boom") {
+		t.Fatalf("expected the crash to be logged with the default format:\n%s", out.String())
+	}
+	if got := s.Panics(); !slices.Equal(got, []string{"boom", "boom"}) {
+		t.Fatalf("expected the default format in the panic history, got %q", got)
+	}
+}
+
+type customPanic struct{ code int }
+
+// Test that Run exposes the original panic value when the policy stops
+// after a panic.
+func TestRunReturnsPanicValue(t *testing.T) {
+	err := Run(context.Background(), Config{
+		RestartPolicy: RestartNever,
+		Logger:        discardLogger,
+	}, func(ctx context.Context) {
+		panic(customPanic{code: 42})
+	})
+
+	var pe *PanicError
+	if !errors.As(err, &pe) {
+		t.Fatalf("expected a *PanicError, got %v", err)
+	}
+	if v, ok := pe.Value.(customPanic); !ok || v.code != 42 {
+		t.Fatalf("expected the original customPanic, got %#v", pe.Value)
+	}
+
+	if err := Run(context.Background(), Config{
+		RestartPolicy: RestartNever,
+		Logger:        discardLogger,
+	}, func(ctx context.Context) {}); err != nil {
+		t.Fatalf("expected nil after a clean run, got %v", err)
+	}
+}
+
+// Test that DisableRecover lets a worker panic propagate. Protect runs the
+// worker inline, so the panic reaches this goroutine instead of crashing
+// the test binary.
+func TestDisableRecover(t *testing.T) {
+	runs := 0
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Fatalf("expected the worker's panic to propagate, got %v", r)
+		}
+		if runs != 1 {
+			t.Fatalf("expected no restart, got %d runs", runs)
+		}
+	}()
+
+	Protect(Config{DisableRecover: true, Logger: discardLogger}, func(ctx context.Context) {
+		runs++
+		panic("boom")
+	})(context.Background())
+}
+
+// Test that a worker calling runtime.Goexit is restarted like a crash
+// instead of ending the supervisor.
+func TestSupervisorGoexit(t *testing.T) {
+	rec := NewRecorder()
+	runs := 0
+
+	err := Run(context.Background(), Config{
+		MinBackoff:    time.Millisecond,
+		RestartPolicy: RestartOnFailure,
+		Logger:        discardLogger,
+		Observer:      rec,
+	}, func(ctx context.Context) {
+		runs++
+		if runs == 1 {
+			runtime.Goexit()
+		}
+	})
+
+	if err != nil || runs != 2 {
+		t.Fatalf("expected a clean second run, got %d runs and %v", runs, err)
+	}
+	if exit := rec.Events()[1]; exit.Kind != RecordExit || exit.Attempt.Err != ErrGoexit {
+		t.Fatalf("expected the first run to exit with ErrGoexit, got %+v", exit)
+	}
+}
@@ -0,0 +1,41 @@
+package supervisor
+
+import "time"
+
+// RestartPolicy decides whether a finished run is followed by a restart.
+type RestartPolicy int
+
+const (
+	// RestartAlways restarts the worker whether it crashed or returned.
+	RestartAlways RestartPolicy = iota
+
+	// RestartOnFailure restarts the worker only if it panicked, returned
+	// an error, or was cancelled by the supervisor (for example for being
+	// idle). A clean return stops the supervisor.
+	RestartOnFailure
+
+	// RestartNever runs the worker once and then stops the supervisor.
+	RestartNever
+
+	// RestartOnEarlyExit is RestartOnFailure for workers that should loop
+	// until they are stopped: a clean return within Config.MinRunDuration
+	// is taken for a worker that silently gave up, and restarted like a
+	// failure, while one after a run of at least MinRunDuration is
+	// expected end-of-life and stops the supervisor.
+	RestartOnEarlyExit
+)
+
+// restarts reports whether a run that ended as described should be
+// followed by another one. minRun is Config.MinRunDuration.
+func (p RestartPolicy) restarts(exit ExitInfo, minRun time.Duration) bool {
+	switch p {
+	case RestartOnFailure:
+		return exit.Failed()
+	case RestartOnEarlyExit:
+		return exit.Failed() || exit.Duration < minRun
+	case RestartNever:
+		return false
+	default:
+		return true
+	}
+}
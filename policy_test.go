@@ -0,0 +1,93 @@
+package supervisor
+
+import (
+	"context"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that RestartNever runs once and exits without a restart log.
+func TestRestartPolicyNever(t *testing.T) {
+	var out syncBuffer
+	runs := 0
+
+	s := Start(context.Background(), Config{
+		MinBackoff:    time.Hour,
+		RestartPolicy: RestartNever,
+		Logger:        log.New(&out, "", 0),
+	}, func(ctx context.Context) {
+		runs++
+		panic("boom")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("supervisor did not exit promptly")
+	}
+
+	if runs != 1 {
+		t.Fatalf("expected a single run, got %d", runs)
+	}
+	if strings.Contains(out.String(), "restarting") {
+		t.Fatalf("unexpected restart log:\n%s", out.String())
+	}
+}
+
+// Test that RestartOnFailure restarts crashes but not clean returns.
+func TestRestartPolicyOnFailure(t *testing.T) {
+	runs := 0
+
+	s := Start(context.Background(), Config{
+		MinBackoff:    time.Millisecond,
+		RestartPolicy: RestartOnFailure,
+		Logger:        discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		if runs < 3 {
+			panic("boom")
+		}
+	})
+	s.Wait()
+
+	if runs != 3 {
+		t.Fatalf("expected 3 runs, got %d", runs)
+	}
+}
+
+// Test that RestartOnEarlyExit restarts clean returns within
+// MinRunDuration and stops after one that ran long enough.
+func TestRestartPolicyOnEarlyExit(t *testing.T) {
+	runs := 0
+
+	s := Start(context.Background(), Config{
+		MinBackoff:     time.Millisecond,
+		RestartPolicy:  RestartOnEarlyExit,
+		MinRunDuration: 20 * time.Millisecond,
+		Logger:         discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		switch runs {
+		case 1:
+			panic("boom")
+		case 3:
+			time.Sleep(30 * time.Millisecond)
+		}
+	})
+	s.Wait()
+
+	if runs != 3 {
+		t.Fatalf("expected 3 runs, got %d", runs)
+	}
+	if s.StopReason() != StopCompleted {
+		t.Fatalf("expected StopCompleted, got %v", s.StopReason())
+	}
+}
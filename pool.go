@@ -0,0 +1,193 @@
+package supervisor
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// A Pool supervises many workers while sharing one goroutine for all of
+// their restart waits. A supervisor started with Start normally keeps a
+// goroutine of its own for its whole life, most of it asleep in backoff;
+// one started through a Pool has no goroutine at all while it backs off.
+// Instead, the Pool keeps the pending restarts in a min-heap ordered by
+// due time and starts each worker's next run when it is due.
+//
+// Worker runs, RestartGate waits and IdleStop pauses still take a
+// goroutine each. Backoff and InitialDelay waits use the real clock;
+// Config.After is not used for them. The zero Pool is ready to use, and
+// its goroutine only runs while some restart is pending.
+type Pool struct {
+	mu      sync.Mutex
+	pending poolHeap
+	entries map[*Supervisor]*poolEntry
+	running bool
+	wakeup  chan struct{}
+}
+
+// poolEntry is a supervisor waiting in a Pool for its next run.
+type poolEntry struct {
+	s     *Supervisor
+	at    time.Time
+	gated bool // wait for RestartGate before running
+	index int
+}
+
+// Start is like the package-level Start, but the supervisor's restart
+// waits are handled by p.
+func (p *Pool) Start(ctx context.Context, cfg Config, worker func(ctx context.Context)) *Supervisor {
+	return p.start(ctx, cfg, errorless(worker))
+}
+
+// StartFunc is like the package-level StartFunc, but the supervisor's
+// restart waits are handled by p.
+func (p *Pool) StartFunc(ctx context.Context, cfg Config, worker func(ctx context.Context) error) *Supervisor {
+	return p.start(ctx, cfg, worker)
+}
+
+func (p *Pool) start(ctx context.Context, cfg Config, worker func(ctx context.Context) error) *Supervisor {
+	s := newSupervisor(ctx, cfg, worker)
+	s.pool = p
+	context.AfterFunc(s.ctx, func() { p.wake(s) })
+
+	s.startedAt = time.Now()
+	if s.cfg.InitialDelay > 0 {
+		p.schedule(s, s.startedAt.Add(s.cfg.InitialDelay), false)
+	} else {
+		go s.runPooled(false)
+	}
+	return s
+}
+
+// runPooled runs steps of the supervisor's loop until it stops or has to
+// back off, at which point it hands the wait to the pool and returns.
+func (s *Supervisor) runPooled(gated bool) {
+	defer func() {
+		if s.cfg.DisableRecover {
+			return
+		}
+		if r := recover(); r != nil {
+			s.internalPanic(r)
+			s.finish()
+		}
+	}()
+
+	for {
+		if gated {
+			s.waitGate()
+			s.logRelaunch()
+		}
+
+		r, ok := s.step()
+		if !ok {
+			s.finish()
+			return
+		}
+		if r.wait && r.backoff > 0 {
+			s.pool.schedule(s, time.Now().Add(r.backoff), true)
+			return
+		}
+		gated = r.wait
+	}
+}
+
+// schedule queues s to run again at the given time.
+func (p *Pool) schedule(s *Supervisor, at time.Time, gated bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.entries == nil {
+		p.entries = make(map[*Supervisor]*poolEntry)
+		p.wakeup = make(chan struct{}, 1)
+	}
+	if s.stopping() {
+		// Stopped before the entry existed for wake to find.
+		at = time.Now()
+	}
+	e := &poolEntry{s: s, at: at, gated: gated}
+	heap.Push(&p.pending, e)
+	p.entries[s] = e
+
+	if !p.running {
+		p.running = true
+		go p.run()
+	} else {
+		p.notify()
+	}
+}
+
+// wake makes s due at once if it is waiting, so that a stop or drain is
+// noticed without waiting out its backoff.
+func (p *Pool) wake(s *Supervisor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.entries[s]; ok {
+		e.at = time.Now()
+		heap.Fix(&p.pending, e.index)
+		p.notify()
+	}
+}
+
+// notify wakes the pool goroutine. p.mu must be held.
+func (p *Pool) notify() {
+	select {
+	case p.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// run starts due supervisors until none are pending.
+func (p *Pool) run() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		p.mu.Lock()
+		now := time.Now()
+		for len(p.pending) > 0 && !p.pending[0].at.After(now) {
+			e := heap.Pop(&p.pending).(*poolEntry)
+			delete(p.entries, e.s)
+			go e.s.runPooled(e.gated)
+		}
+		if len(p.pending) == 0 {
+			p.running = false
+			p.mu.Unlock()
+			return
+		}
+		timer.Reset(p.pending[0].at.Sub(now))
+		p.mu.Unlock()
+
+		select {
+		case <-timer.C:
+		case <-p.wakeup:
+		}
+	}
+}
+
+// poolHeap is a min-heap of entries by due time.
+type poolHeap []*poolEntry
+
+func (h poolHeap) Len() int           { return len(h) }
+func (h poolHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h poolHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *poolHeap) Push(x any) {
+	e := x.(*poolEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *poolHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,69 @@
+package supervisor
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Test that pooled supervisors use no goroutines of their own while
+// backing off, and still restart and stop normally.
+func TestPoolBackoffWithoutGoroutines(t *testing.T) {
+	const n = 100
+	var p Pool
+	before := runtime.NumGoroutine()
+
+	sups := make([]*Supervisor, n)
+	for i := range sups {
+		sups[i] = p.Start(context.Background(), Config{
+			MinBackoff:  100 * time.Millisecond,
+			MaxBackoff:  100 * time.Millisecond,
+			MaxRestarts: 1,
+			Logger:      discardLogger,
+		}, func(ctx context.Context) {
+			panic("boom")
+		})
+	}
+
+	for _, s := range sups {
+		waitForState(t, s, StateBackingOff)
+	}
+	if extra := runtime.NumGoroutine() - before; extra > 10 {
+		t.Fatalf("expected backing-off supervisors to share a goroutine, got %d extra goroutines", extra)
+	}
+
+	for _, s := range sups {
+		s.Wait()
+		if s.RestartCount() != 1 || s.State() != StateGaveUp {
+			t.Fatalf("expected one restart then a give-up, got %d restarts in %v", s.RestartCount(), s.State())
+		}
+	}
+}
+
+// Test that cancelling a pooled supervisor interrupts its backoff.
+func TestPoolCancelDuringBackoff(t *testing.T) {
+	var p Pool
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := p.Start(ctx, Config{
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	waitForState(t, s, StateBackingOff)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cancel did not interrupt the pooled backoff")
+	}
+}
@@ -0,0 +1,61 @@
+package supervisor
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// StartProcess supervises an external process with the same restart and
+// backoff semantics as Start.
+//
+// cmd is called before every run to build a fresh *exec.Cmd, since a Cmd
+// cannot be started twice. A process that exits with a non-zero status, or
+// fails to start, is treated as a failed run. When the supervisor stops,
+// the process is sent SIGTERM and, if it has not exited after
+// cfg.ShutdownTimeout, killed.
+func StartProcess(ctx context.Context, cfg Config, cmd func() *exec.Cmd) *Supervisor {
+	if cmd == nil {
+		panic(nilWorkerPanic)
+	}
+	grace := cfg.ShutdownTimeout
+	if grace == 0 {
+		grace = 5 * time.Second
+	}
+
+	return StartFunc(ctx, cfg, func(ctx context.Context) error {
+		return runProcess(ctx, cmd(), grace)
+	})
+}
+
+// runProcess runs cmd until it exits or ctx is done, in which case the
+// process is terminated gracefully and its exit status ignored.
+func runProcess(ctx context.Context, cmd *exec.Cmd, grace time.Duration) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+
+	select {
+	case err := <-waited:
+		return err
+	case <-ctx.Done():
+	}
+
+	// SIGTERM is not supported everywhere (notably Windows); fall back to
+	// killing the process outright.
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		cmd.Process.Kill()
+	}
+
+	select {
+	case <-waited:
+	case <-time.After(grace):
+		cmd.Process.Kill()
+		<-waited
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package supervisor
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func requireShell(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+}
+
+// Test that a process exiting non-zero is restarted.
+func TestStartProcessRestartsOnFailure(t *testing.T) {
+	requireShell(t)
+
+	runs := 0
+	s := StartProcess(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+	}, func() *exec.Cmd {
+		runs++
+		return exec.Command("sh", "-c", "exit 1")
+	})
+	s.Wait()
+
+	if runs != 3 {
+		t.Fatalf("expected 3 runs, got %d", runs)
+	}
+}
+
+// Test that stopping the supervisor terminates the process.
+func TestStartProcessTerminatesOnStop(t *testing.T) {
+	requireShell(t)
+
+	s := StartProcess(context.Background(), Config{
+		Logger:          discardLogger,
+		ShutdownTimeout: 100 * time.Millisecond,
+	}, func() *exec.Cmd {
+		return exec.Command("sh", "-c", "sleep 10")
+	})
+
+	waitForState(t, s, StateRunning)
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("process was not terminated on stop")
+	}
+}
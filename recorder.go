@@ -0,0 +1,138 @@
+package supervisor
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RecordKind identifies the lifecycle point a Record was made at.
+type RecordKind string
+
+// The kinds of Record, one per Observer method.
+const (
+	RecordStart   RecordKind = "start"
+	RecordExit    RecordKind = "exit"
+	RecordPanic   RecordKind = "panic"
+	RecordRestart RecordKind = "restart"
+	RecordStop    RecordKind = "stop"
+	RecordGiveUp  RecordKind = "giveup"
+)
+
+// A Record is one lifecycle event seen by a Recorder. Only the fields
+// relevant to its Kind are set.
+type Record struct {
+	Time time.Time
+	Kind RecordKind
+
+	// Attempt is set for RecordStart, RecordExit and RecordRestart.
+	Attempt *Attempt
+
+	// Panic is set for RecordPanic.
+	Panic *PanicError
+
+	// LastErr is set for RecordGiveUp, as passed to Config.OnGiveUp.
+	LastErr any
+}
+
+// A Recorder is an Observer that records every lifecycle event, for
+// testing supervised code. Set it as Config.Observer, then inspect it or
+// wait on it:
+//
+//	rec := supervisor.NewRecorder()
+//	s := supervisor.Start(ctx, supervisor.Config{Observer: rec}, worker)
+//	rec.WaitFor(supervisor.RecordRestart, 3)
+//
+// A Recorder is safe for concurrent use. Use one per supervisor.
+type Recorder struct {
+	mu      sync.Mutex
+	records []Record
+	changed chan struct{} // closed and replaced on each new record
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{changed: make(chan struct{})}
+}
+
+func (r *Recorder) add(rec Record) {
+	rec.Time = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, rec)
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+// Events returns everything recorded so far, oldest first.
+func (r *Recorder) Events() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.records)
+}
+
+// Count returns how many records of kind have been made.
+func (r *Recorder) Count(kind RecordKind) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.countLocked(kind)
+}
+
+func (r *Recorder) countLocked(kind RecordKind) int {
+	n := 0
+	for _, rec := range r.records {
+		if rec.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// RestartCount returns how many restarts have been recorded.
+func (r *Recorder) RestartCount() int {
+	return r.Count(RecordRestart)
+}
+
+// WaitFor blocks until at least n records of kind have been made. It
+// returns false without waiting further if the supervisor stops first.
+func (r *Recorder) WaitFor(kind RecordKind, n int) bool {
+	for {
+		r.mu.Lock()
+		count, stopped, changed := r.countLocked(kind), r.countLocked(RecordStop) > 0, r.changed
+		r.mu.Unlock()
+
+		if count >= n {
+			return true
+		}
+		if stopped {
+			return false
+		}
+		<-changed
+	}
+}
+
+func (r *Recorder) OnStart(ctx context.Context, a *Attempt) {
+	r.add(Record{Kind: RecordStart, Attempt: a})
+}
+
+func (r *Recorder) OnExit(a *Attempt) {
+	r.add(Record{Kind: RecordExit, Attempt: a})
+}
+
+func (r *Recorder) OnPanic(err *PanicError) {
+	r.add(Record{Kind: RecordPanic, Panic: err})
+}
+
+func (r *Recorder) OnRestart(ctx context.Context, a *Attempt) {
+	r.add(Record{Kind: RecordRestart, Attempt: a})
+}
+
+func (r *Recorder) OnStop() {
+	r.add(Record{Kind: RecordStop})
+}
+
+func (r *Recorder) OnGiveUp(lastErr any) {
+	r.add(Record{Kind: RecordGiveUp, LastErr: lastErr})
+}
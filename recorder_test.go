@@ -0,0 +1,52 @@
+package supervisor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Test that a Recorder records the lifecycle and can be waited on.
+func TestRecorder(t *testing.T) {
+	rec := NewRecorder()
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+		Observer:    rec,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+
+	if !rec.WaitFor(RecordRestart, 2) {
+		t.Fatal("supervisor stopped before 2 restarts")
+	}
+	s.Wait()
+
+	if n := rec.RestartCount(); n != 2 {
+		t.Fatalf("expected 2 restarts, got %d", n)
+	}
+	if n := rec.Count(RecordPanic); n != 3 {
+		t.Fatalf("expected 3 panics, got %d", n)
+	}
+	if rec.WaitFor(RecordRestart, 3) {
+		t.Fatal("expected WaitFor to give up once the supervisor stopped")
+	}
+
+	events := rec.Events()
+	for _, e := range events {
+		if e.Kind != RecordExit {
+			continue
+		}
+		if a := e.Attempt; a.EndedAt.Before(a.StartedAt) || a.StartedAt.IsZero() || a.PanicValue != "boom" {
+			t.Fatalf("incomplete attempt %d: %+v", a.Number, a)
+		}
+	}
+	if last := events[len(events)-1]; last.Kind != RecordStop || last.Time.IsZero() {
+		t.Fatalf("expected a timestamped stop last, got %+v", last)
+	}
+	if gu := events[len(events)-2]; gu.Kind != RecordGiveUp || gu.LastErr != "boom" {
+		t.Fatalf("expected the give-up before the stop, got %+v", gu)
+	}
+}
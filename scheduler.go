@@ -0,0 +1,41 @@
+package supervisor
+
+import (
+	"errors"
+	"time"
+)
+
+// A Scheduler decides, after each run, whether the worker is restarted and
+// how long to wait first. Setting Config.Scheduler replaces the built-in
+// decision entirely: RestartPolicy, Backoff, ImmediateFirstRetry,
+// FastRestartOn and the backoff tuning fields are then ignored.
+// MaxRestarts still applies.
+type Scheduler interface {
+	// NextDelay is called with the attempt that just ended and how it
+	// ended, and returns the delay before the next run, or restart=false
+	// to stop the supervisor. It is only called from the supervisor
+	// goroutine.
+	NextDelay(attempt int, lastExit ExitInfo) (delay time.Duration, restart bool)
+}
+
+// defaultScheduler is the Scheduler used when Config.Scheduler is unset:
+// RestartPolicy decides whether to restart and the backoff strategy how
+// long to wait.
+type defaultScheduler struct {
+	cfg      Config
+	strategy BackoffStrategy
+}
+
+func (d defaultScheduler) NextDelay(attempt int, exit ExitInfo) (time.Duration, bool) {
+	if !d.cfg.RestartPolicy.restarts(exit, d.cfg.MinRunDuration) {
+		return 0, false
+	}
+	if d.cfg.ImmediateFirstRetry && attempt == 1 {
+		return 0, true
+	}
+	var pe *PanicError
+	if d.cfg.FastRestartOn != nil && errors.As(exit.Err, &pe) && d.cfg.FastRestartOn(pe.Value) {
+		return 0, true
+	}
+	return d.strategy.Next(exit), true
+}
@@ -0,0 +1,48 @@
+package supervisor
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// scriptedScheduler restarts with the given delays, then stops.
+type scriptedScheduler struct {
+	delays   []time.Duration
+	attempts []int
+}
+
+func (s *scriptedScheduler) NextDelay(attempt int, exit ExitInfo) (time.Duration, bool) {
+	s.attempts = append(s.attempts, attempt)
+	if attempt > len(s.delays) {
+		return 0, false
+	}
+	return s.delays[attempt-1], true
+}
+
+// Test that a Scheduler overrides RestartPolicy and the backoff settings.
+func TestSupervisorScheduler(t *testing.T) {
+	ms := time.Millisecond
+	sched := &scriptedScheduler{delays: []time.Duration{3 * ms, ms}}
+	runs := 0
+
+	got := runBackoffs(Config{
+		MinBackoff:    time.Hour,
+		MaxBackoff:    time.Hour,
+		RestartPolicy: RestartNever,
+		Scheduler:     sched,
+	}, func(ctx context.Context) {
+		runs++
+	})
+
+	if !equalDurations(got, sched.delays) {
+		t.Fatalf("expected backoffs %v, got %v", sched.delays, got)
+	}
+	if runs != 3 {
+		t.Fatalf("expected 3 runs, got %d", runs)
+	}
+	if want := []int{1, 2, 3}; !slices.Equal(sched.attempts, want) {
+		t.Fatalf("expected attempts %v, got %v", want, sched.attempts)
+	}
+}
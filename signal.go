@@ -0,0 +1,22 @@
+package supervisor
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// WithSignals returns a copy of ctx that is cancelled when one of the given
+// signals arrives, or when the returned CancelFunc is called.
+//
+// If no signals are given, SIGINT and SIGTERM are used. Pass the returned
+// context to Start so that supervised workers shut down on Ctrl-C or a
+// termination request from the orchestrator. Call the CancelFunc once the
+// context is no longer needed to release the signal registration.
+func WithSignals(ctx context.Context, signals ...os.Signal) (context.Context, context.CancelFunc) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return signal.NotifyContext(ctx, signals...)
+}
@@ -0,0 +1,45 @@
+package supervisor
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Test that the context returned by WithSignals is cancelled on a signal.
+func TestWithSignalsCancelsOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sending os.Interrupt is not supported on windows")
+	}
+
+	ctx, cancel := WithSignals(context.Background(), os.Interrupt)
+	defer cancel()
+
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(1 * time.Second):
+		t.Fatal("context was not cancelled after signal")
+	}
+}
+
+// Test that the returned CancelFunc cancels the context.
+func TestWithSignalsCancelFunc(t *testing.T) {
+	ctx, cancel := WithSignals(context.Background())
+	cancel()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("context was not cancelled by CancelFunc")
+	}
+}
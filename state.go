@@ -0,0 +1,112 @@
+package supervisor
+
+// State describes what a supervisor is currently doing.
+type State int
+
+const (
+	// StateStarting is the state before the first run begins, including
+	// any InitialDelay.
+	StateStarting State = iota
+
+	// StateRunning means the worker is executing.
+	StateRunning
+
+	// StateBackingOff means the worker has exited and the supervisor is
+	// waiting before restarting it.
+	StateBackingOff
+
+	// StateIdle means the worker was stopped for being idle and is
+	// waiting for Resume.
+	StateIdle
+
+	// StateStopped means the supervisor has exited and will not run the
+	// worker again.
+	StateStopped
+
+	// StateGaveUp means the supervisor exited because its restart budget
+	// was exhausted.
+	StateGaveUp
+
+	// StateCircuitOpen means a CircuitBreaker has tripped and the
+	// supervisor is waiting out its cooldown before a trial run.
+	StateCircuitOpen
+
+	// StateHalfOpen means a CircuitBreaker's trial run is executing and
+	// has not yet stayed up long enough to close the circuit.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateBackingOff:
+		return "backing off"
+	case StateIdle:
+		return "idle"
+	case StateStopped:
+		return "stopped"
+	case StateGaveUp:
+		return "gave up"
+	case StateCircuitOpen:
+		return "circuit open"
+	case StateHalfOpen:
+		return "half open"
+	default:
+		return "unknown"
+	}
+}
+
+// MarshalText encodes the state as its String form, so it reads naturally
+// in JSON status output.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// StopReason describes why a supervisor stopped.
+type StopReason int
+
+const (
+	// StopNone means the supervisor has not stopped.
+	StopNone StopReason = iota
+
+	// StopCancelled means its context was cancelled or Stop was called.
+	StopCancelled
+
+	// StopDrained means Drain was called.
+	StopDrained
+
+	// StopCompleted means the restart policy or Scheduler declined to
+	// restart after a run that returned cleanly.
+	StopCompleted
+
+	// StopGaveUp means MaxRestarts or MaxTotalBackoff was exhausted.
+	StopGaveUp
+
+	// StopFatal means the supervisor stopped because of a failure it does
+	// not restart from: FailFastOnFirstPanic, the restart policy or
+	// Scheduler declining to restart after a failed run, or a panic in
+	// the supervisor itself or a hook it called.
+	StopFatal
+)
+
+func (r StopReason) String() string {
+	switch r {
+	case StopNone:
+		return "none"
+	case StopCancelled:
+		return "cancelled"
+	case StopDrained:
+		return "drained"
+	case StopCompleted:
+		return "completed"
+	case StopGaveUp:
+		return "gave up"
+	case StopFatal:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
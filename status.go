@@ -0,0 +1,230 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status is a point-in-time summary of a supervisor.
+type Status struct {
+	Name      string
+	State     State
+	Restarts  int
+	LastCrash time.Time // zero if the worker has never failed
+	Backoff   time.Duration
+	Panics    []string // recent panic values; see Supervisor.Panics
+}
+
+// Status returns a snapshot of the supervisor's current status.
+func (s *Supervisor) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statusLocked()
+}
+
+func (s *Supervisor) statusLocked() Status {
+	return Status{
+		Name:      s.cfg.Name,
+		State:     s.stateLocked(),
+		Restarts:  s.restarts,
+		LastCrash: s.lastCrash,
+		Backoff:   s.backoff,
+		Panics:    slices.Clone(s.panics),
+	}
+}
+
+// registry holds the supervisors started with Config.Register that have
+// not stopped yet, in the order they were started.
+var registry struct {
+	mu          sync.Mutex
+	supervisors []*Supervisor
+}
+
+func register(s *Supervisor) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.supervisors = append(registry.supervisors, s)
+}
+
+func unregister(s *Supervisor) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.supervisors = slices.DeleteFunc(registry.supervisors, func(r *Supervisor) bool {
+		return r == s
+	})
+}
+
+// Snapshot returns the status of every running supervisor that was started
+// with Config.Register, in the order they were started. The statuses are
+// read at a single instant: no registered supervisor changes state while
+// the snapshot is taken.
+func Snapshot() []Status {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+
+	for _, s := range registry.supervisors {
+		s.mu.Lock()
+	}
+	statuses := make([]Status, len(registry.supervisors))
+	for i, s := range registry.supervisors {
+		statuses[i] = s.statusLocked()
+	}
+	for _, s := range registry.supervisors {
+		s.mu.Unlock()
+	}
+	return statuses
+}
+
+// RestartCount returns how many times the worker has been restarted.
+func (s *Supervisor) RestartCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Uptime returns the total time the worker has spent running since the
+// supervisor started, including the current run.
+func (s *Supervisor) Uptime() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.uptimeLocked(time.Now())
+}
+
+func (s *Supervisor) uptimeLocked(now time.Time) time.Duration {
+	up := s.uptime
+	if s.runDone != nil {
+		up += now.Sub(s.runStarted)
+	}
+	return up
+}
+
+// Availability returns the fraction of time the worker was running out of
+// the time it was either running or waiting to be restarted (backing off
+// or held by RestartGate), from 0 to 1. Time spent stopped, idle (see
+// IdleStop) or in InitialDelay is not counted. It returns 0 until the
+// worker has run.
+func (s *Supervisor) Availability() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	up := s.uptimeLocked(now)
+	down := s.downtime
+	if !s.downSince.IsZero() {
+		down += now.Sub(s.downSince)
+	}
+	if up+down == 0 {
+		return 0
+	}
+	return float64(up) / float64(up+down)
+}
+
+// WaitForRestarts blocks until RestartCount reaches n. It returns ctx's
+// error if ctx is done first, or ErrStopped if the supervisor stops first.
+func (s *Supervisor) WaitForRestarts(ctx context.Context, n int) error {
+	for {
+		s.mu.Lock()
+		restarts, restarted := s.restarts, s.restarted
+		s.mu.Unlock()
+
+		if restarts >= n {
+			return nil
+		}
+		select {
+		case <-restarted:
+		case <-s.done:
+			if s.RestartCount() >= n {
+				return nil
+			}
+			return ErrStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// CurrentBackoff returns the most recent backoff: the wait in progress
+// while the supervisor is backing off, and otherwise the last one applied.
+// Preventive restarts, which do not back off, leave it unchanged. It is
+// zero before the first backoff.
+func (s *Supervisor) CurrentBackoff() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.backoff
+}
+
+// NextRestartAt returns when the worker is due to be restarted, or the
+// zero time if the supervisor is not currently backing off or waiting out
+// a CircuitBreaker's cooldown.
+func (s *Supervisor) NextRestartAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != StateBackingOff && s.state != StateCircuitOpen {
+		return time.Time{}
+	}
+	return s.backoffAt.Add(s.backoff)
+}
+
+type statusJSON struct {
+	Name      string    `json:"name"`
+	State     State     `json:"state"`
+	Restarts  int       `json:"restarts"`
+	LastCrash time.Time `json:"last_crash,omitzero"`
+	Backoff   string    `json:"backoff"`
+	BackoffMS int64     `json:"backoff_ms"`
+}
+
+var statusTemplate = template.Must(template.New("status").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Supervisors</title></head>
+<body>
+<table>
+<tr><th>Name</th><th>State</th><th>Restarts</th><th>Last crash</th><th>Backoff</th></tr>
+{{range .}}<tr><td>{{.Name}}</td><td>{{.State}}</td><td>{{.Restarts}}</td><td>{{if not .LastCrash.IsZero}}{{.LastCrash.Format "2006-01-02T15:04:05Z07:00"}}{{end}}</td><td>{{.Backoff}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// StatusHandler returns an http.Handler that renders the status of the
+// given supervisors, typically mounted at /debug/supervisors.
+//
+// The response is a JSON array with one object per supervisor. Requests
+// with ?format=html, or whose Accept header prefers text/html, get an HTML
+// table instead.
+func StatusHandler(supervisors ...*Supervisor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]Status, len(supervisors))
+		for i, s := range supervisors {
+			statuses[i] = s.Status()
+		}
+
+		if r.URL.Query().Get("format") == "html" || strings.HasPrefix(r.Header.Get("Accept"), "text/html") {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			statusTemplate.Execute(w, statuses)
+			return
+		}
+
+		out := make([]statusJSON, len(statuses))
+		for i, st := range statuses {
+			out[i] = statusJSON{
+				Name:      st.Name,
+				State:     st.State,
+				Restarts:  st.Restarts,
+				LastCrash: st.LastCrash,
+				Backoff:   st.Backoff.String(),
+				BackoffMS: st.Backoff.Milliseconds(),
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(out)
+	})
+}
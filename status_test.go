@@ -0,0 +1,220 @@
+package supervisor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that StatusHandler renders supervisors as JSON.
+func TestStatusHandlerJSON(t *testing.T) {
+	s := Start(context.Background(), Config{
+		Name:       "crasher",
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	defer s.Stop()
+
+	waitForState(t, s, StateBackingOff)
+
+	rec := httptest.NewRecorder()
+	StatusHandler(s).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/supervisors", nil))
+
+	var got []map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", rec.Body.String(), err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("expected 1 supervisor, got %d", len(got))
+	}
+
+	st := got[0]
+	if st["name"] != "crasher" || st["state"] != "backing off" || st["restarts"] != 1.0 || st["backoff"] != "1h0m0s" {
+		t.Fatalf("unexpected status %v", st)
+	}
+	if _, ok := st["last_crash"]; !ok {
+		t.Fatalf("expected last_crash in %v", st)
+	}
+}
+
+// Test that StatusHandler renders HTML on request.
+func TestStatusHandlerHTML(t *testing.T) {
+	s := Start(context.Background(), Config{Name: "html-worker", Logger: discardLogger}, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	defer s.Stop()
+
+	rec := httptest.NewRecorder()
+	StatusHandler(s).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/supervisors?format=html", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("expected HTML content type, got %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "<td>html-worker</td>") {
+		t.Fatalf("supervisor missing from HTML:\n%s", rec.Body.String())
+	}
+}
+
+// Test that NextRestartAt reflects the pending backoff.
+func TestNextRestartAt(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s := Start(context.Background(), Config{
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) {
+		close(started)
+		<-release
+		panic("boom")
+	})
+	defer s.Stop()
+
+	<-started
+	if at := s.NextRestartAt(); !at.IsZero() {
+		t.Fatalf("expected zero NextRestartAt while running, got %v", at)
+	}
+
+	before := time.Now()
+	close(release)
+	waitForState(t, s, StateBackingOff)
+
+	at := s.NextRestartAt()
+	if at.Before(before.Add(time.Hour)) || at.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("NextRestartAt %v not about an hour from now", at)
+	}
+}
+
+// Test that NextRestartAt counts down a circuit breaker's cooldown too.
+func TestNextRestartAtCircuitOpen(t *testing.T) {
+	before := time.Now()
+	s := Start(context.Background(), Config{
+		Logger: discardLogger,
+		Backoff: CircuitBreaker(CircuitBreakerConfig{
+			Threshold: 1,
+			Cooldown:  time.Hour,
+		}),
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	defer s.Stop()
+
+	waitForState(t, s, StateCircuitOpen)
+	at := s.NextRestartAt()
+	if at.Before(before.Add(time.Hour)) || at.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("NextRestartAt %v not about an hour from now", at)
+	}
+}
+
+// Test that WaitForRestarts returns once the count is reached, and reports
+// a stop or a done context otherwise.
+func TestWaitForRestarts(t *testing.T) {
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		MaxRestarts: 3,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.WaitForRestarts(ctx, 2); err != nil {
+		t.Fatalf("waiting for 2 restarts: %v", err)
+	}
+	if n := s.RestartCount(); n < 2 {
+		t.Fatalf("returned after %d restarts", n)
+	}
+
+	if err := s.WaitForRestarts(ctx, 4); err != ErrStopped {
+		t.Fatalf("expected ErrStopped after giving up at 3, got %v", err)
+	}
+
+	blocked := Start(context.Background(), Config{Logger: discardLogger}, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	defer blocked.Stop()
+
+	short, cancelShort := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelShort()
+	if err := blocked.WaitForRestarts(short, 1); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+// Test that Uptime counts time running and Availability weighs it against
+// time spent backing off.
+func TestUptimeAndAvailability(t *testing.T) {
+	const d = 30 * time.Millisecond
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  d,
+		MaxBackoff:  d,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		time.Sleep(d)
+		panic("boom")
+	})
+	if a := s.Availability(); a < 0 || a > 1 {
+		t.Fatalf("availability %v out of range", a)
+	}
+	s.Wait()
+
+	// Three runs and two backoffs of d each.
+	if up := s.Uptime(); up < 3*d || up > 6*d {
+		t.Fatalf("expected uptime around %v, got %v", 3*d, up)
+	}
+	if a := s.Availability(); a < 0.4 || a > 0.8 {
+		t.Fatalf("expected availability around 0.6, got %v", a)
+	}
+
+	// Time stopped is not counted.
+	a := s.Availability()
+	time.Sleep(d)
+	if got := s.Availability(); got != a {
+		t.Fatalf("availability changed while stopped: %v -> %v", a, got)
+	}
+}
+
+// Test that Snapshot reports registered supervisors while they run.
+func TestSnapshot(t *testing.T) {
+	block := func(ctx context.Context) {
+		<-ctx.Done()
+	}
+
+	a := Start(context.Background(), Config{Name: "a", Register: true, Logger: discardLogger}, block)
+	b := Start(context.Background(), Config{Name: "b", Logger: discardLogger}, block)
+	c := Start(context.Background(), Config{Name: "c", Register: true, Logger: discardLogger}, block)
+	defer b.Stop()
+	defer c.Stop()
+	waitForState(t, a, StateRunning)
+	waitForState(t, c, StateRunning)
+
+	names := func() []string {
+		var names []string
+		for _, st := range Snapshot() {
+			names = append(names, st.Name)
+		}
+		return names
+	}
+
+	if got := names(); !slices.Equal(got, []string{"a", "c"}) {
+		t.Fatalf("expected registered supervisors a and c, got %v", got)
+	}
+
+	a.Stop()
+	a.Wait()
+	if got := names(); !slices.Equal(got, []string{"c"}) {
+		t.Fatalf("expected a stopped supervisor to be dropped, got %v", got)
+	}
+}
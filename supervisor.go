@@ -2,8 +2,18 @@ package supervisor
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log"
-	"math"
+	"runtime/debug"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,65 +43,1917 @@ Usage example:
         }
     })
 
-To stop all supervised workers, cancel the context you passed into Start().
+To stop all supervised workers, cancel the context you passed into Start(),
+or call Stop() on the returned *Supervisor and Wait() for it to finish.
 */
 
 type Config struct {
 	MinBackoff time.Duration
 	MaxBackoff time.Duration
 	Logger     *log.Logger
+
+	// Jitter randomly spreads each backoff by up to +/- this fraction
+	// (0.1 means +/-10%) so that many workers crashing together do not
+	// restart in lockstep. Zero disables jitter. See NextBackoff.
+	Jitter float64
+
+	// JitterMode selects another way to randomize the backoff, such as
+	// JitterFull or JitterEqual. The default, JitterProportional, is the
+	// +/- Jitter spread described above.
+	JitterMode JitterMode
+
+	// BackoffFactor is how much the backoff grows after each restart. It
+	// defaults to 2; values of 1 or less would never grow the backoff, so
+	// they are rejected by Validate and otherwise replaced by the default
+	// with a warning.
+	BackoffFactor float64
+
+	// Backoff replaces the built-in exponential backoff with another
+	// strategy, such as CircuitBreaker. Built-in strategies get their own
+	// state per supervisor, so a Config holding one can be reused.
+	Backoff BackoffStrategy
+
+	// ImmediateFirstRetry restarts the worker without delay after its
+	// first run, on the assumption that a first crash is usually a
+	// transient blip. The backoff strategy is not consulted for that
+	// restart, so the second restart waits MinBackoff and growth starts
+	// from there.
+	ImmediateFirstRetry bool
+
+	// FastRestartOn classifies panic values: when it returns true for the
+	// value a run panicked with, the worker is restarted without any
+	// backoff, and the backoff does not grow. This lets a worker panic
+	// with a known value as a cheap restart signal. Restarts still count
+	// against MaxRestarts.
+	FastRestartOn func(v any) bool
+
+	// BackoffReset decides when the backoff returns to MinBackoff. The
+	// default, NeverReset, keeps growing it for the supervisor's lifetime.
+	BackoffReset BackoffReset
+
+	// ShouldResetBackoff, if set, is called with each run that ended,
+	// before the backoff for the restart is chosen, and returning true
+	// resets the backoff to MinBackoff, as BackoffReset does. It can encode
+	// policies BackoffReset cannot, such as resetting only after a clean
+	// run that lasted a minute; BackoffReset still applies as well. It is
+	// honored by the built-in strategies other than AdaptiveBackoff, and
+	// is called from the supervisor goroutine.
+	ShouldResetBackoff func(a Attempt) bool
+
+	// BackoffDecay makes the backoff recover gradually with uptime: for
+	// every BackoffDecay a run stays up, the backoff steps back down by
+	// one BackoffFactor, until it is back at MinBackoff. A worker that
+	// escalated long ago and has since run for hours thus restarts
+	// quickly, while one that keeps crashing soon after starting still
+	// escalates. Zero disables decay.
+	BackoffDecay time.Duration
+
+	// MaxAttemptsForBackoff stops the backoff from growing after this many
+	// restarts since it was last reset, even if MaxBackoff has not been
+	// reached. This keeps delays predictable when MaxBackoff is very
+	// large. Zero means no limit.
+	MaxAttemptsForBackoff int
+
+	// RunID tags every log line of this supervisor so that its lifecycle
+	// can be followed across restarts. If empty, a short random id is
+	// generated at Start.
+	RunID string
+
+	// InitialDelay postpones the worker's first run. Stopping or draining
+	// the supervisor during the delay ends it without running the worker.
+	InitialDelay time.Duration
+
+	// BaseContext, if set, is called once by Start to produce the parent
+	// of the context passed to the worker and to hooks, like
+	// http.Server.BaseContext. Use it to seed values, such as a tenant id,
+	// that every run and hook should see. The context passed to Start
+	// still stops the supervisor when it is done, and so does the base
+	// context.
+	BaseContext func() context.Context
+
+	// RespectDeadlineGrace lets the current run outlive the deadline of
+	// the context passed to Start by up to this long. When that deadline
+	// passes, the supervisor drains instead of stopping: it makes no more
+	// restarts but leaves the run's context alone, and only cancels it
+	// once the grace period is over (or stops as soon as the run returns).
+	// This overrides the parent's deadline: the worker's context does not
+	// carry it, and is not done when it passes, so a worker that must
+	// react to the deadline should be given it another way. Cancellation
+	// of the parent other than by its deadline still stops the supervisor
+	// at once. Zero disables the grace period.
+	RespectDeadlineGrace time.Duration
+
+	// Name identifies the worker in status output such as StatusHandler.
+	Name string
+
+	// Register adds the supervisor to the package-level registry read by
+	// Snapshot while it runs.
+	Register bool
+
+	// After is used for every wait the supervisor makes (backoff and
+	// InitialDelay). It defaults to time.After; tests can supply their own
+	// channel to advance time without sleeping.
+	After func(d time.Duration) <-chan time.Time
+
+	// RestartPolicy decides which runs are followed by a restart. The
+	// default, RestartAlways, restarts after every run.
+	RestartPolicy RestartPolicy
+
+	// MinRunDuration is how long a run must last for a clean return to
+	// stop the supervisor under RestartOnEarlyExit. Other policies ignore
+	// it.
+	MinRunDuration time.Duration
+
+	// Scheduler, if set, takes over deciding whether and when to restart
+	// from RestartPolicy and the backoff settings. See Scheduler.
+	Scheduler Scheduler
+
+	// MaxRestarts is the number of times the worker may be restarted
+	// before the supervisor gives up and stops. Zero means no limit. The
+	// supervisor gives up as soon as the last allowed run fails, without
+	// waiting out a backoff that no restart would follow.
+	MaxRestarts int
+
+	// MaxTotalBackoff caps the time the supervisor may spend backing off
+	// over its lifetime: it gives up, like after MaxRestarts, instead of
+	// starting a backoff that would take the total past this budget. It
+	// answers "how long will we keep trying" more directly than
+	// MaxRestarts. Time held by RestartGate or LoadGate is not counted,
+	// nor are backoffs during WarmupPeriod. Zero means no limit.
+	MaxTotalBackoff time.Duration
+
+	// WarmupPeriod exempts restarts during this long after the supervisor
+	// starts from MaxRestarts and MaxTotalBackoff, for workers that
+	// reliably crash a few times while their dependencies come up. Those
+	// restarts still back off.
+	WarmupPeriod time.Duration
+
+	// StableThreshold is how long a run must stay up to count as stable,
+	// which closes the channel returned by FirstStable. Zero disables the
+	// check, and FirstStable is then never closed.
+	StableThreshold time.Duration
+
+	// OnStart, if set, is called before each run, from the supervisor
+	// goroutine, and always returns before the worker is called, so it can
+	// set up per-run resources the worker depends on. If it returns an
+	// error the worker is not called for that attempt, which fails with
+	// the error like a run returning it would, and is restarted with
+	// backoff as usual. Observers are only told the run started, and the
+	// start event only emitted, once OnStart has succeeded; a failed
+	// attempt still reaches Observer.OnExit. Its context is bounded by
+	// HookTimeout, but the supervisor waits for it to return nonetheless.
+	OnStart func(ctx context.Context, attempt int) error
+
+	// OnGiveUp is called when the supervisor gives up after MaxRestarts,
+	// with the value the last run panicked with, the error it returned
+	// (see StartFunc), or nil if it returned cleanly.
+	// The supervisor never exits the process itself; to have your
+	// orchestrator replace a process whose worker cannot stay up, exit
+	// from this hook:
+	//
+	//	cfg.OnGiveUp = func(lastErr any) {
+	//		log.Fatalf("worker gave up: %v", lastErr)
+	//	}
+	OnGiveUp func(lastErr any)
+
+	// OnStop is called once the supervisor has stopped for any reason,
+	// after the final worker run has returned and "stopped" is logged, so
+	// anything the worker flushes on shutdown is complete by then.
+	OnStop func()
+
+	// Flush, if set, is called as the very last step of the supervisor,
+	// after OnStop and every observer, just before Wait returns. Use it to
+	// flush a buffered logger or metrics so that the final "stopped" line
+	// is not lost if the process exits right after Wait. With
+	// SyncRestartLog it is also called before each backoff.
+	Flush func()
+
+	// SyncRestartLog makes the restart timeline in the logs unambiguous
+	// for setups whose logs must be durable, in case the process is killed
+	// while backing off: Flush is called right after "restarting worker
+	// in ..." is logged, before the backoff begins, and "relaunching
+	// worker after ..." is logged with the time actually waited, including
+	// RestartGate and LoadGate, once the backoff is over.
+	SyncRestartLog bool
+
+	// OnRestart is called before each restart's backoff wait with the
+	// attempt that just ended and the backoff about to be applied, which
+	// is zero for preventive restarts such as RequestRestart. An Observer
+	// also receives the restart's Cause.
+	OnRestart func(ctx context.Context, attempt int, backoff time.Duration)
+
+	// Observer, if set, is notified at every lifecycle point, after the
+	// matching hook field. See Observer.
+	Observer Observer
+
+	// HookTimeout bounds how long the supervisor waits for a hook such as
+	// OnRestart, OnGiveUp or OnStop. A hook that overruns is logged as
+	// timed out and left running in the background while the supervisor
+	// proceeds; its context is cancelled so it can give up. Zero waits
+	// indefinitely.
+	HookTimeout time.Duration
+
+	// FailFastOnFirstPanic stops the supervisor if the worker panics on
+	// its very first run, which usually means a startup misconfiguration
+	// that backing off will not fix. The panic is reported through
+	// OnGiveUp and Err (and Run's result) as a *GaveUpError. Panics in
+	// later runs are restarted as usual.
+	FailFastOnFirstPanic bool
+
+	// DisableRecover lets panics in the worker go unrecovered, crashing
+	// the process with the original stack and stopping a debugger at the
+	// panic site, instead of being caught and restarted. Panics in the
+	// supervisor itself and in hooks are not recovered either. It is meant
+	// for development only.
+	DisableRecover bool
+
+	// LogRunDuration adds how long the worker had been running to each
+	// crash log, as in "worker crashed after 3m12s: boom". A worker that
+	// crashes after seconds usually fails differently from one that
+	// crashes after hours. The duration is always in PanicError.Duration.
+	LogRunDuration bool
+
+	// CaptureStack logs the worker's stack trace along with each crash.
+	CaptureStack bool
+
+	// MaxStackBytes truncates captured stacks to at most this many bytes,
+	// marking the cut with "...(truncated)". The top frames, which are
+	// usually the interesting ones, are kept. Zero means no limit.
+	MaxStackBytes int
+
+	// EventSink, if set, receives one JSON object per line for each
+	// lifecycle event (start, crash, restart, fallback, stop, giveup), for
+	// shipping to a log pipeline independently of Logger. Every object has
+	// ts, event, run_id, attempt and, if set, name; restarts add cause and
+	// backoff_ms, crashes add panic or error, and starts after the first
+	// add restart_latency_ms (see Attempt.RestartLatency).
+	EventSink io.Writer
+
+	// LogSampler decides, per attempt (starting at 1), whether that
+	// attempt's crash and restart lines are logged. It defaults to logging
+	// every attempt. To get a sense of scale for a worker stuck in a crash
+	// loop without a line per restart, log powers of two only:
+	//
+	//	cfg.LogSampler = func(attempt int) bool {
+	//		return attempt&(attempt-1) == 0
+	//	}
+	//
+	// Other lifecycle lines, and EventSink events, are not sampled.
+	LogSampler func(attempt int) bool
+
+	// MinLogInterval rate-limits lifecycle lines, such as "restarting
+	// worker in ...", for workers that flap: at most one is logged per
+	// interval, and the number dropped is logged when logging resumes or
+	// the supervisor stops. Crash lines, and the lines for stopping and
+	// giving up, are always logged. Zero disables the limit.
+	MinLogInterval time.Duration
+
+	// FormatPanic renders panic values wherever the supervisor logs them
+	// and in PanicError.Error. It defaults to fmt.Sprintf("%v", v), or
+	// "%+v" for error values, to include the detail some error packages
+	// add. If FormatPanic itself panics, the default is used instead.
+	FormatPanic func(v any) string
+
+	// ShutdownTimeout is how long StartProcess waits after sending SIGTERM
+	// to a child process on shutdown before killing it, and how long the
+	// supervisor waits for work started by hooks with Async when it stops.
+	// Defaults to 5s.
+	ShutdownTimeout time.Duration
+
+	// ShutdownGrace is how long the context returned by ShutdownContext
+	// stays valid after the run's context is done, for final I/O such as
+	// flushing to a remote service during teardown. Zero makes
+	// ShutdownContext return the run's context unchanged.
+	ShutdownGrace time.Duration
+
+	// PprofLabels labels the goroutine of each run with supervisor (the
+	// Name, or the RunID if unnamed), run and attempt, so goroutine
+	// profiles and dumps show which supervisor owns which goroutine.
+	// Labels add a small cost to every run, so they are off by default.
+	PprofLabels bool
+
+	// RunTimeout bounds each run with a context deadline. A run whose
+	// deadline expires counts as failed and is restarted with backoff; its
+	// context's cause is ErrRunTimeout. Zero means no deadline.
+	RunTimeout time.Duration
+
+	// RunDeadlineFunc, if set, overrides RunTimeout with a deadline chosen
+	// per attempt (starting at 1), for example to give a slowly-recovering
+	// dependency more time on later attempts. A non-positive result means
+	// no deadline for that run.
+	RunDeadlineFunc func(attempt int) time.Duration
+
+	// ResourceProbe, if set, is polled every ResourceProbeInterval while
+	// the worker runs. When it returns true, for example because the
+	// worker is close to leaking its way out of file descriptors, the run
+	// is cancelled with ErrResourceLimit and restarted straight away, as a
+	// preventive restart: there is no backoff, the backoff does not grow,
+	// and the restart does not count against MaxRestarts. A probe that
+	// panics, as MemoryProbe may too, is logged and taken as no restart.
+	ResourceProbe func(ctx context.Context) (restart bool)
+
+	// ResourceProbeInterval is how often ResourceProbe and MemoryProbe
+	// are polled. Defaults to 10s.
+	ResourceProbeInterval time.Duration
+
+	// MemoryProbe and MemoryLimit guard against slow memory leaks. While
+	// the worker runs, MemoryProbe is polled every ResourceProbeInterval;
+	// once it reports more than MemoryLimit bytes the run is cancelled
+	// with ErrMemoryLimit and restarted straight away, like a
+	// ResourceProbe restart. Go cannot attribute memory to a goroutine, so
+	// the probe is whatever approximation suits the worker, such as the
+	// heap size from runtime/metrics or the size of a cache it owns. A
+	// MemoryLimit of zero disables the guard.
+	MemoryProbe func() uint64
+	MemoryLimit uint64
+
+	// RestartSignal, if set, restarts the worker each time a value is
+	// received from it while the worker runs, for example after its
+	// configuration changed. The run is cancelled with ErrConfigChanged
+	// and restarted straight away, like a ResourceProbe restart. Signals
+	// sent between runs are not consumed.
+	RestartSignal <-chan struct{}
+
+	// RestartGate, if set, must return nil before a restart proceeds. It
+	// is checked after the backoff wait; while it returns an error the
+	// restart is held and the gate retried every RestartGateInterval.
+	// Use it to hold off restarts until there is capacity for the worker,
+	// such as room in a shared queue.
+	RestartGate func(ctx context.Context) error
+
+	// LoadGate, if set, reports whether the host is overloaded, for
+	// example from its load average. It is checked alongside RestartGate:
+	// while it returns true the restart is held and the gate retried every
+	// RestartGateInterval, so that a crashing worker does not add to the
+	// load by restarting aggressively.
+	LoadGate func() (overloaded bool)
+
+	// RestartGateInterval is how often a closed RestartGate or LoadGate
+	// is retried. Defaults to 1s.
+	RestartGateInterval time.Duration
+
+	// IdleTimeout cancels a run that has not called Heartbeat within this
+	// window. What happens next is decided by IdleAction. Zero disables
+	// idle detection.
+	IdleTimeout time.Duration
+
+	// IdleAction selects what the supervisor does with an idle worker.
+	// The default, IdleRestart, treats it like a crash.
+	IdleAction IdleAction
+
+	// AbandonTimeout detects hard crashes, such as a worker stuck in cgo
+	// code that Go cannot interrupt or recover from. Once an idle run (see
+	// IdleTimeout) has had its context cancelled, the supervisor waits up
+	// to this long for it to return; if it does not, the run is presumed
+	// dead, fails with ErrAbandoned and is restarted. The abandoned
+	// goroutine is left behind, and if it ever resumes it runs alongside
+	// the new run, so the worker must tolerate that. Zero waits for every
+	// run to return. It has no effect with DisableRecover.
+	AbandonTimeout time.Duration
+
+	// MaxUninterruptible caps how long a unit of work in progress in
+	// Uninterruptible holds off IdleTimeout and AbandonTimeout. While a
+	// unit is in progress, the run is neither cancelled for being idle nor
+	// abandoned; if it is still in progress this long after either would
+	// have happened, it happens anyway. Defaults to 1m.
+	MaxUninterruptible time.Duration
+
+	// StartWindow is how long a run may hold its SetMaxConcurrentRestarts
+	// slot while the worker initializes: the slot is freed when the worker
+	// calls Ready, when the window elapses or when the run ends. Zero frees
+	// it as soon as the worker function is entered.
+	StartWindow time.Duration
 }
 
 func DefaultConfig() Config {
 	return Config{
-		MinBackoff: 1 * time.Second,
-		MaxBackoff: 30 * time.Second,
-		Logger:     log.Default(),
+		MinBackoff:    1 * time.Second,
+		MaxBackoff:    30 * time.Second,
+		BackoffFactor: defaultBackoffFactor,
+		Logger:        log.Default(),
 	}
 }
 
+// Supervisor is a handle to a supervised worker started by Start.
+//
+// A Supervisor is single-use: once it has stopped, it never runs its worker
+// again and its counters and history are final. Use Clone to start a fresh
+// supervisor with the same configuration and worker.
+type Supervisor struct {
+	cfg  Config
+	orig Config // cfg as passed in, before defaults were applied
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	drainOnce sync.Once
+	drain     chan struct{}
+
+	finishOnce sync.Once
+
+	beat   chan struct{}
+	resume chan struct{}
+
+	// mu guards the fields below it that are read by the handle's
+	// methods. They are only written by the supervisor goroutine.
+	mu         sync.Mutex
+	state      State
+	restarts   int
+	restarted  chan struct{} // closed and replaced each time restarts grows
+	backoff    time.Duration
+	backoffAt  time.Time // when the current backoff wait started
+	runStarted time.Time
+	runDone    chan struct{} // closed when the current run returns; nil between runs
+	uptime     time.Duration // total length of finished runs
+	downtime   time.Duration // total time spent waiting to restart, excluding the current wait
+	downSince  time.Time     // when the current wait to restart began; zero if not waiting
+	lastCrash  time.Time
+	panics     []string // formatted values of recent panics, oldest first
+	err        error    // why supervision ended, once it has; see Err
+	degraded   bool     // running fallback; see StartWithFallback
+	stopReason StopReason
+
+	// These fields are guarded by mu too, but are also used by handle
+	// methods: ReplaceWorker writes worker and calls runCancel, which
+	// cancels the current run and is nil between runs, and
+	// SetBackoffBounds leaves new bounds for the loop to apply.
+	worker    func(ctx context.Context) error
+	runCancel context.CancelCauseFunc
+	bounds    *[2]time.Duration
+
+	// attempt is the current attempt number. Only the supervisor
+	// goroutine changes it, but logging reads it from other goroutines
+	// too, such as Async work and abandoned runs.
+	attempt atomic.Int64
+
+	// These fields are owned by the supervisor goroutine.
+	startedAt  time.Time     // when the loop began, for WarmupPeriod
+	budgetUsed int           // restarts counted against MaxRestarts
+	backedOff  time.Duration // backoff counted against MaxTotalBackoff
+	lastExit   ExitReason
+	lastEnded  time.Time // when the previous run ended, for RestartLatency
+	strategy   BackoffStrategy
+	scheduler  Scheduler
+	observers  []Observer
+	lastLogged time.Time // when lifecyclef last logged
+	suppressed int       // lines lifecyclef dropped since
+
+	// fallback, if set, replaces worker once it exhausts MaxRestarts.
+	fallback func(ctx context.Context) error
+
+	// pool, if set, handles the supervisor's restart waits; see Pool.
+	pool *Pool
+
+	// ready and firstExit are set by StartSync, which waits for the first
+	// run to call Ready or to end with firstErr.
+	readyOnce sync.Once
+	ready     chan struct{}
+	firstExit chan struct{}
+	firstErr  error
+
+	// firstError delivers the first run's outcome; see FirstError.
+	firstOnce  sync.Once
+	firstError chan error
+
+	// async tracks the work hooks started with Async.
+	async asyncWork
+
+	// firstStable is closed once a run has lasted StableThreshold.
+	stableOnce  sync.Once
+	firstStable chan struct{}
+
+	// hookSlots, if set, is a semaphore shared by a group's supervisors
+	// that bounds how many hooks run at once.
+	hookSlots chan struct{}
+
+	// onRestart, if set, is called each time the worker is restarted.
+	// Groups use it to track restarts across their workers.
+	onRestart func()
+
+	// onGiveUp, if set, is called after the supervisor gives up. Groups
+	// use it for essential workers.
+	onGiveUp func()
+
+	// barrier, if set, is what Barrier calls for this supervisor's runs.
+	// Groups set it to their start barrier.
+	barrier func(ctx context.Context) error
+
+	// tokens, if set, is the rate limiter WaitToken uses, shared by a
+	// group's supervisors.
+	tokens *tokenBucket
+}
+
 // Start launches a supervised worker that auto-restarts on panic.
 //
 // The worker function must block (usually via an infinite loop) and exit
 // only when ctx.Done() is closed. If the worker panics, the supervisor
 // catches the panic and restarts it using exponential backoff.
-func Start(ctx context.Context, cfg Config, worker func(ctx context.Context)) {
+//
+// The returned Supervisor can be used to stop the worker and wait for it;
+// cancelling ctx has the same effect as calling Stop. Start, like the other
+// entry points, panics if worker is nil.
+func Start(ctx context.Context, cfg Config, worker func(ctx context.Context)) *Supervisor {
+	return StartFunc(ctx, cfg, errorless(worker))
+}
+
+// StartFunc is like Start for workers that report failure by returning an
+// error. A run that returns a non-nil error is logged and restarted with
+// backoff exactly like a run that panicked. Wrap the worker with
+// Recovering to have panics reach the supervisor as errors too.
+func StartFunc(ctx context.Context, cfg Config, worker func(ctx context.Context) error) *Supervisor {
+	s := newSupervisor(ctx, cfg, worker)
+	go s.loop()
+	return s
+}
+
+// StartSync is like Start, but blocks until the worker's first run has
+// either called Ready or ended, so that the caller can rely on the worker
+// having initialized before going on with its own startup. The error is
+// the first run's failure, if it ended with one (a *PanicError, for
+// example); the supervisor keeps running in the background either way,
+// restarting the worker as usual.
+func StartSync(ctx context.Context, cfg Config, worker func(ctx context.Context)) (*Supervisor, error) {
+	s := newSupervisor(ctx, cfg, errorless(worker))
+	s.ready = make(chan struct{})
+	s.firstExit = make(chan struct{})
+	go s.loop()
+
+	select {
+	case <-s.ready:
+		return s, nil
+	case <-s.firstExit:
+		return s, s.firstErr
+	case <-s.done:
+		return s, s.Err()
+	}
+}
+
+// Run is like Start but supervises the worker in the calling goroutine,
+// blocking until supervision ends. It returns the supervisor's final error
+// (see Supervisor.Err): nil after ctx is cancelled, a *GaveUpError if the
+// supervisor gave up, or the final run's error if the restart policy
+// stopped after it failed. A panic is reported as a *PanicError holding
+// the original value, reachable with errors.As in every case. If cfg is
+// invalid, Run returns the Validate error without running the worker.
+func Run(ctx context.Context, cfg Config, worker func(ctx context.Context)) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	s := newSupervisor(ctx, cfg, errorless(worker))
+	s.loop()
+	return s.Err()
+}
+
+// RunFor supervises worker for d, or until ctx is done, then stops it and
+// returns its final status along with its Err. It captures the common test
+// pattern of starting a worker, letting it run briefly and stopping it.
+func RunFor(ctx context.Context, cfg Config, worker func(ctx context.Context), d time.Duration) (*Status, error) {
+	s := Start(ctx, cfg, worker)
+	select {
+	case <-time.After(d):
+	case <-s.done:
+	}
+	s.Stop()
+	s.Wait()
+
+	st := s.Status()
+	return &st, s.Err()
+}
+
+// StartFactory supervises workers produced by factory, which is called at
+// the start of every attempt. Use it when each run needs resources that
+// can fail to be acquired, such as a dialed connection the worker closes
+// over.
+//
+// If factory returns an error, no worker runs and the attempt counts as
+// failed, with backoff applied as for a crash. Otherwise the returned
+// worker runs and is supervised as with Start.
+func StartFactory(ctx context.Context, cfg Config, factory func(ctx context.Context) (func(ctx context.Context), error)) *Supervisor {
+	if factory == nil {
+		panic(nilWorkerPanic)
+	}
+	return StartFunc(ctx, cfg, func(ctx context.Context) error {
+		worker, err := factory(ctx)
+		if err != nil {
+			return fmt.Errorf("worker factory: %w", err)
+		}
+		worker(ctx)
+		return nil
+	})
+}
+
+// StartHandoff is like Start for a stateful worker that hands state from
+// one run to the next, such as an in-memory cache, so that restarts are
+// warm. Each run receives the state the previous run returned, and nil on
+// the first run. A run that panics returns nothing, so the next run
+// receives the last state that was returned, or nil if none was.
+//
+// The state is shared by the runs of the returned supervisor only; a Clone
+// shares it too, so it should not normally be cloned.
+func StartHandoff(ctx context.Context, cfg Config, worker func(ctx context.Context, incoming any) (outgoing any)) *Supervisor {
+	if worker == nil {
+		panic(nilWorkerPanic)
+	}
+	var mu sync.Mutex
+	var state any
+	return Start(ctx, cfg, func(ctx context.Context) {
+		mu.Lock()
+		incoming := state
+		mu.Unlock()
+
+		outgoing := worker(ctx, incoming)
+
+		mu.Lock()
+		state = outgoing
+		mu.Unlock()
+	})
+}
+
+// StartWithFallback is like Start, but when primary exhausts MaxRestarts
+// or MaxTotalBackoff the supervisor switches to supervising fallback
+// instead of giving up, for graceful degradation: for example, reading
+// from a local cache when the consumer of a live feed cannot stay up. The
+// switch is logged and fallback starts straight away with a fresh backoff
+// and budgets of its own; the supervisor only gives up once fallback
+// exhausts them too.
+// Degraded reports whether the switch has happened.
+func StartWithFallback(ctx context.Context, cfg Config, primary, fallback func(ctx context.Context)) *Supervisor {
+	return startWithFallback(ctx, cfg, errorless(primary), errorless(fallback))
+}
+
+func startWithFallback(ctx context.Context, cfg Config, primary, fallback func(ctx context.Context) error) *Supervisor {
+	s := newSupervisor(ctx, cfg, primary)
+	s.fallback = fallback
+	go s.loop()
+	return s
+}
+
+// Protect returns a function that supervises worker inline, in the
+// goroutine that calls it, instead of in a background goroutine as Start
+// does. Use it to embed supervision into a goroutine you already manage.
+//
+// The returned function applies cfg exactly like Start and blocks until
+// supervision ends: its ctx is cancelled, the restart policy declines a
+// restart, or the supervisor gives up.
+func Protect(cfg Config, worker func(ctx context.Context)) func(ctx context.Context) {
+	run := errorless(worker)
+	return func(ctx context.Context) {
+		newSupervisor(ctx, cfg, run).loop()
+	}
+}
+
+// nilWorkerPanic is the panic value for a nil worker, raised by the entry
+// points so that the mistake surfaces at the call site rather than in the
+// supervisor goroutine.
+const nilWorkerPanic = "supervisor: worker must not be nil"
+
+// errorless adapts a worker for Start to the error-returning form.
+func errorless(worker func(ctx context.Context)) func(ctx context.Context) error {
+	if worker == nil {
+		panic(nilWorkerPanic)
+	}
+	return func(ctx context.Context) error {
+		worker(ctx)
+		return nil
+	}
+}
+
+// newSupervisor applies defaults to cfg and returns a supervisor that is
+// ready to run but not yet started.
+func newSupervisor(ctx context.Context, cfg Config, worker func(ctx context.Context) error) *Supervisor {
+	if worker == nil {
+		panic(nilWorkerPanic)
+	}
+	orig := cfg
+
+	cfg.sanitize()
 	if cfg.MinBackoff == 0 {
 		cfg.MinBackoff = 1 * time.Second
 	}
 	if cfg.MaxBackoff == 0 {
 		cfg.MaxBackoff = 30 * time.Second
 	}
+	cfg.MaxBackoff = max(cfg.MaxBackoff, cfg.MinBackoff)
 	if cfg.Logger == nil {
 		cfg.Logger = log.Default()
 	}
+	if cfg.After == nil {
+		cfg.After = time.After
+	}
+	if cfg.ResourceProbeInterval == 0 {
+		cfg.ResourceProbeInterval = 10 * time.Second
+	}
+	if cfg.RestartGateInterval == 0 {
+		cfg.RestartGateInterval = 1 * time.Second
+	}
+	if cfg.FormatPanic == nil {
+		cfg.FormatPanic = formatPanic
+	} else {
+		cfg.FormatPanic = safeFormat(cfg.FormatPanic)
+	}
+
+	if cfg.RunID == "" {
+		cfg.RunID = newRunID()
+	}
+
+	s := &Supervisor{
+		cfg:    cfg,
+		orig:   orig,
+		worker: worker,
+		done:   make(chan struct{}),
+		drain:  make(chan struct{}),
+		beat:   make(chan struct{}, 1),
+		resume: make(chan struct{}, 1),
+
+		restarted:   make(chan struct{}),
+		state:       StateStarting,
+		firstStable: make(chan struct{}),
+		firstError:  make(chan error, 1),
+	}
+	_, hasDeadline := ctx.Deadline()
+	grace := hasDeadline && s.cfg.RespectDeadlineGrace > 0
+	if s.cfg.BaseContext == nil && !grace {
+		s.ctx, s.cancel = context.WithCancel(ctx)
+	} else {
+		base := context.WithoutCancel(ctx)
+		if s.cfg.BaseContext != nil {
+			base = s.cfg.BaseContext()
+			if base == nil {
+				panic("supervisor: BaseContext returned a nil context")
+			}
+		}
+		var cancel context.CancelFunc
+		s.ctx, cancel = context.WithCancel(base)
+		parentDone := cancel
+		if grace {
+			parentDone = func() {
+				if ctx.Err() != context.DeadlineExceeded {
+					cancel()
+					return
+				}
+				s.Drain()
+				time.AfterFunc(s.cfg.RespectDeadlineGrace, cancel)
+			}
+		}
+		stop := context.AfterFunc(ctx, parentDone)
+		s.cancel = func() {
+			stop()
+			cancel()
+		}
+	}
+
+	for _, err := range orig.problems() {
+		s.logf("%v", err)
+	}
+	if s.cfg.BackoffFactor <= 1 {
+		s.cfg.BackoffFactor = defaultBackoffFactor
+	}
+
+	s.strategy = bindBackoff(s.cfg)
+	s.observers = observersFor(&s.cfg)
+	if s.cfg.Register {
+		register(s)
+	}
+	s.scheduler = s.cfg.Scheduler
+	if s.scheduler == nil {
+		s.scheduler = defaultScheduler{cfg: s.cfg, strategy: s.strategy}
+	}
+
+	return s
+}
+
+// Config returns the configuration s runs with: the Config it was started
+// with, with defaults filled in and invalid values replaced.
+func (s *Supervisor) Config() Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// SetBackoffBounds changes MinBackoff and MaxBackoff for the restarts that
+// follow, for example to widen the backoff during an incident, without
+// restarting the supervisor. The built-in strategies keep their state and
+// pick up the new bounds from the next restart; a custom Backoff strategy
+// is not affected. It returns an error, and changes nothing, unless
+// 0 < min <= max.
+func (s *Supervisor) SetBackoffBounds(min, max time.Duration) error {
+	if min <= 0 {
+		return fmt.Errorf("invalid MinBackoff %v: must be positive", min)
+	}
+	if min > max {
+		return fmt.Errorf("invalid MinBackoff %v: exceeds MaxBackoff %v", min, max)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bounds = &[2]time.Duration{min, max}
+	return nil
+}
+
+// applyBounds applies the bounds passed to SetBackoffBounds, if any.
+func (s *Supervisor) applyBounds() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bounds == nil {
+		return
+	}
+	min, max := s.bounds[0], s.bounds[1]
+	s.bounds = nil
+	s.cfg.MinBackoff, s.cfg.MaxBackoff = min, max
+	if r, ok := s.strategy.(rebounder); ok {
+		r.setBounds(min, max)
+	}
+}
+
+// Clone starts a new supervisor under ctx with the same configuration and
+// worker as s, but with fresh counters and history. Defaults are applied
+// again, so an unset RunID gets a new random id. s itself is unaffected.
+func (s *Supervisor) Clone(ctx context.Context) *Supervisor {
+	s.mu.Lock()
+	worker := s.worker
+	s.mu.Unlock()
+
+	if s.fallback != nil {
+		return startWithFallback(ctx, s.orig, worker, s.fallback)
+	}
+	return StartFunc(ctx, s.orig, worker)
+}
+
+// ReplaceWorker installs worker in place of the current worker function,
+// for example to hot-reload a plugin, without stopping the supervisor. The
+// next run uses it. If restart is set, the current run, if any, is also
+// cancelled with ErrWorkerReplaced so that the new worker takes over at
+// once; this is a preventive restart like one from RequestRestart. A
+// supervisor that has switched to its fallback (see StartWithFallback)
+// keeps running the fallback. ReplaceWorker panics if worker is nil.
+func (s *Supervisor) ReplaceWorker(worker func(ctx context.Context), restart bool) {
+	run := errorless(worker)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.worker = run
+	if restart && s.runCancel != nil {
+		s.runCancel(ErrWorkerReplaced)
+	}
+}
+
+// Stop cancels the worker's context and prevents any further restarts.
+// It does not wait for the worker to return; use Wait for that.
+func (s *Supervisor) Stop() {
+	s.cancel()
+}
+
+// Drain prevents any further restarts but, unlike Stop, leaves the
+// worker's context alone so that the current run can finish on its own.
+// If the supervisor is backing off between runs, it stops immediately.
+func (s *Supervisor) Drain() {
+	s.drainOnce.Do(func() { close(s.drain) })
+	if s.pool != nil {
+		s.pool.wake(s)
+	}
+}
+
+// Wait blocks until the supervisor has stopped and the last worker run
+// has returned.
+func (s *Supervisor) Wait() {
+	<-s.done
+}
+
+// maxPanicHistory is how many recent panics Panics retains.
+const maxPanicHistory = 32
+
+// Panics returns the values of the worker's most recent panics, oldest
+// first, as formatted by FormatPanic. Up to 32 are kept. Comparing them
+// after a give-up shows whether one bug kept recurring or the failures
+// changed along the way.
+func (s *Supervisor) Panics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.panics)
+}
+
+// markReady releases StartSync and FirstError; see Ready.
+func (s *Supervisor) markReady() {
+	if s.ready != nil {
+		s.readyOnce.Do(func() { close(s.ready) })
+	}
+	s.deliverFirst(nil)
+}
+
+// deliverFirst delivers err on FirstError's channel, unless an outcome
+// was delivered already.
+func (s *Supervisor) deliverFirst(err error) {
+	s.firstOnce.Do(func() {
+		s.firstError <- err
+		close(s.firstError)
+	})
+}
+
+// StopReason returns why the supervisor stopped, or StopNone while it is
+// still running. It is also part of the final "stopped" log line.
+func (s *Supervisor) StopReason() StopReason {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != StateStopped && s.state != StateGaveUp {
+		return StopNone
+	}
+	return s.stopReason
+}
+
+// Err returns why supervision ended: a *GaveUpError if the supervisor gave
+// up; the last run's error, such as a *PanicError, if the restart policy
+// or Scheduler declined to restart after a failed run; a *PanicError if
+// the supervisor itself, or a hook it called, panicked; or nil if it is
+// still running, was stopped or drained, or its last run returned cleanly.
+func (s *Supervisor) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// WaitIdle blocks until the worker is not executing: it returns at once
+// if the supervisor is between runs or stopped, and otherwise as soon as
+// the current run returns. Unlike Wait it does not wait for supervision to
+// end, so a new run may begin right after it returns; pair it with Stop or
+// Drain to be sure shared resources are no longer in use.
+func (s *Supervisor) WaitIdle() {
+	s.mu.Lock()
+	runDone := s.runDone
+	s.mu.Unlock()
+
+	if runDone != nil {
+		<-runDone
+	}
+}
+
+// Resume restarts a worker that was stopped for being idle (see
+// IdleStop). It has no effect in any other state.
+func (s *Supervisor) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != StateIdle {
+		return
+	}
+	select {
+	case s.resume <- struct{}{}:
+	default:
+	}
+}
+
+// State reports what the supervisor is currently doing.
+func (s *Supervisor) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stateLocked()
+}
+
+// stateLocked returns the current state; s.mu must be held. A circuit
+// breaker's trial run counts as fully resumed once it has stayed up for
+// the breaker's StableThreshold.
+func (s *Supervisor) stateLocked() State {
+	if s.state == StateHalfOpen {
+		cb := s.strategy.(*circuitBreaker)
+		if time.Since(s.runStarted) >= cb.conf.StableThreshold {
+			return StateRunning
+		}
+	}
+	return s.state
+}
+
+func (s *Supervisor) setState(state State) {
+	s.mu.Lock()
+	s.state = state
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) loop() {
+	defer s.finish()
+	defer func() {
+		if s.cfg.DisableRecover {
+			return
+		}
+		if r := recover(); r != nil {
+			s.internalPanic(r)
+		}
+	}()
+
+	s.startedAt = time.Now()
+	if s.cfg.InitialDelay > 0 {
+		s.sleep(s.cfg.InitialDelay)
+	}
+
+	for {
+		r, ok := s.step()
+		if !ok {
+			return
+		}
+		if r.wait {
+			s.sleep(r.backoff)
+			s.waitGate()
+			s.logRelaunch()
+		}
+	}
+}
+
+// internalPanic records a panic of the supervisor goroutine itself, or of
+// a hook it called, with value r. The supervisor then stops as usual, so
+// that OnStop and Flush still run, with Err reporting the panic.
+func (s *Supervisor) internalPanic(r any) {
+	pe := &PanicError{Value: r, Stack: debug.Stack(), format: s.cfg.FormatPanic}
+	s.logf("internal panic: %s\n%s", s.cfg.FormatPanic(r), pe.Stack)
+	s.mu.Lock()
+	s.err = pe
+	s.stopReason = StopFatal
+	s.mu.Unlock()
+}
+
+// finish marks the supervisor stopped once its loop has ended. Only the
+// first call does anything, so that runPooled can call it again after a
+// panic that escaped the first.
+func (s *Supervisor) finish() {
+	s.finishOnce.Do(s.markStopped)
+}
+
+func (s *Supervisor) markStopped() {
+	defer close(s.done)
+	if s.cfg.Flush != nil {
+		defer s.recoverHook(s.cfg.Flush)
+	}
+	defer s.cancel()
+
+	s.waitAsync()
+	s.mu.Lock()
+	if s.state != StateGaveUp {
+		s.state = StateStopped
+	}
+	if s.stopReason == StopNone {
+		s.stopReason = StopDrained
+		if s.ctx.Err() != nil {
+			s.stopReason = StopCancelled
+		}
+	}
+	reason, restarts := s.stopReason, s.budgetUsed
+	s.endDowntimeLocked(time.Now())
+	s.mu.Unlock()
+	if s.cfg.Register {
+		unregister(s)
+	}
+	s.deliverFirst(ErrStopped)
+
+	s.flushSuppressed()
+	if reason == StopGaveUp {
+		s.logf("stopped (gave up after %d restarts)", restarts)
+	} else {
+		s.logf("stopped (%v)", reason)
+	}
+	s.emit(event{Event: "stop"})
+	s.observe(func(_ context.Context, o Observer) { s.recoverHook(o.OnStop) })
+}
+
+// recoverHook calls hook, recording a panic as internalPanic does. finish
+// runs after the loop's own recover, so without it a panicking OnStop or
+// Flush would crash the process.
+func (s *Supervisor) recoverHook(hook func()) {
+	defer func() {
+		if s.cfg.DisableRecover {
+			return
+		}
+		if r := recover(); r != nil {
+			s.internalPanic(r)
+		}
+	}()
+	hook()
+}
+
+// A restart is what step decided should happen before the next run.
+type restart struct {
+	// wait is set for a regular restart, which waits out backoff and then
+	// RestartGate. Other restarts, such as preventive ones, run at once.
+	wait    bool
+	backoff time.Duration
+}
+
+// step runs the worker once and decides what happens next. It reports
+// false once the supervisor should stop.
+func (s *Supervisor) step() (restart, bool) {
+	select {
+	case <-s.ctx.Done():
+		return restart{}, false
+	case <-s.drain:
+		s.logf("drained")
+		return restart{}, false
+	default:
+	}
+	release, ok := runSlots.acquire(s.ctx.Done(), s.drain)
+	if !ok {
+		return restart{}, false
+	}
+	defer release()
+
+	attempt := int(s.attempt.Add(1))
+	state := StateRunning
+	if cb, ok := s.strategy.(*circuitBreaker); ok {
+		state = cb.beginRun()
+	}
+	started := time.Now()
+	runDone := make(chan struct{})
+	s.mu.Lock()
+	s.state = state
+	s.runStarted = started
+	s.runDone = runDone
+	s.endDowntimeLocked(started)
+	s.mu.Unlock()
+
+	cur := Attempt{Number: attempt, StartedAt: started}
+	if !s.lastEnded.IsZero() {
+		cur.RestartLatency = started.Sub(s.lastEnded)
+	}
+	var cause error
+	err := s.startHook(attempt)
+	if err == nil {
+		s.emit(event{Event: "start", RestartLatencyMS: cur.RestartLatency.Milliseconds()})
+		s.observeAttempt(cur, func(ctx context.Context, o Observer, a *Attempt) { o.OnStart(ctx, a) })
+		err, cause = s.runIsolated(release)
+	}
+	release()
+	ran := time.Since(started)
+
+	s.mu.Lock()
+	s.runDone = nil
+	s.runCancel = nil
+	s.uptime += ran
+	s.mu.Unlock()
+	close(runDone)
+	exit := ExitInfo{
+		Attempt:  attempt,
+		Reason:   exitReasonOf(err),
+		Err:      err,
+		Duration: ran,
+	}
+	if exit.Err == nil {
+		exit.Err = cause
+	}
+	s.lastExit = exit.Reason
+	if err != nil {
+		// Format outside mu: FormatPanic is the user's code.
+		pe, isPanic := err.(*PanicError)
+		var formatted string
+		if isPanic {
+			formatted = s.cfg.FormatPanic(pe.Value)
+		}
+		s.mu.Lock()
+		s.lastCrash = time.Now()
+		if isPanic {
+			s.panics = append(s.panics, formatted)
+			if len(s.panics) > maxPanicHistory {
+				s.panics = s.panics[len(s.panics)-maxPanicHistory:]
+			}
+		}
+		s.mu.Unlock()
+		s.emitCrash(err)
+	}
+	if attempt == 1 && s.firstExit != nil {
+		s.firstErr = exit.Err
+		close(s.firstExit)
+	}
+	if attempt == 1 {
+		s.deliverFirst(exit.Err)
+	}
+	cur.EndedAt = started.Add(ran)
+	s.lastEnded = cur.EndedAt
+	cur.ExitReason = exit.Reason
+	cur.Err = exit.Err
+	if pe, ok := err.(*PanicError); ok {
+		cur.PanicValue, cur.Stack = pe.Value, pe.Stack
+		s.observe(func(_ context.Context, o Observer) { o.OnPanic(pe) })
+	}
+	s.observeAttempt(cur, func(_ context.Context, o Observer, a *Attempt) { o.OnExit(a) })
+
+	// A run that ended because the supervisor is shutting down is never
+	// restarted: go straight back to the top of the loop, which stops.
+	if s.stopping() {
+		return restart{}, true
+	}
+
+	if s.cfg.FailFastOnFirstPanic && exit.Attempt == 1 && exit.Reason == ExitPanic {
+		s.logf("worker panicked on its first run, failing fast")
+		s.giveUp(exit, StopFatal)
+		return restart{}, false
+	}
+
+	if cause == ErrRunTimeout {
+		s.logf("worker exceeded its run deadline")
+	}
+	if cause == ErrIdle {
+		if s.cfg.IdleAction == IdleStop {
+			s.logf("worker idle for %v, stopping until resumed", s.cfg.IdleTimeout)
+			s.setState(StateIdle)
+			s.waitResume()
+			return restart{}, true
+		}
+		s.lifecyclef("worker idle for %v, restarting", s.cfg.IdleTimeout)
+	}
+	if cause == ErrResourceLimit || cause == ErrMemoryLimit || cause == ErrConfigChanged || cause == ErrWorkerReplaced || cause == ErrRestartRequested {
+		// A preventive restart: no backoff, no escalation, and it does
+		// not count against MaxRestarts.
+		switch cause {
+		case ErrResourceLimit:
+			s.lifecyclef("resource probe requested a restart")
+		case ErrMemoryLimit:
+			s.lifecyclef("memory above %d bytes, restarting", s.cfg.MemoryLimit)
+		case ErrConfigChanged:
+			s.lifecyclef("restart signalled")
+		case ErrWorkerReplaced:
+			s.lifecyclef("worker replaced, restarting")
+		default:
+			s.lifecyclef("worker requested a restart")
+		}
+		s.mu.Lock()
+		s.addRestartLocked()
+		s.mu.Unlock()
+		cur.Cause = restartCauseOf(exit.Reason, cause)
+		s.emit(event{Event: "restart", Cause: cur.Cause.String()})
+		s.observeAttempt(cur, func(ctx context.Context, o Observer, a *Attempt) { o.OnRestart(ctx, a) })
+		return restart{}, true
+	}
+
+	s.applyBounds()
+	if s.cfg.ShouldResetBackoff != nil && s.cfg.ShouldResetBackoff(cur) {
+		if r, ok := s.strategy.(resetter); ok {
+			r.reset()
+		}
+	}
+
+	// Decide whether to restart at all before logging or sleeping, so
+	// that a run-once configuration exits promptly and quietly.
+	backoff, again := s.scheduler.NextDelay(attempt, exit)
+	if !again {
+		s.mu.Lock()
+		s.err = exit.Err
+		s.stopReason = StopCompleted
+		if exit.Failed() {
+			s.stopReason = StopFatal
+		}
+		s.mu.Unlock()
+		return restart{}, false
+	}
+	warmingUp := time.Since(s.startedAt) < s.cfg.WarmupPeriod
+	exhausted := !warmingUp && s.cfg.MaxRestarts > 0 && s.budgetUsed >= s.cfg.MaxRestarts
+	overBackoff := !warmingUp && s.cfg.MaxTotalBackoff > 0 && s.backedOff+backoff > s.cfg.MaxTotalBackoff
+	if exhausted || overBackoff {
+		if s.fallback != nil && !s.degraded {
+			s.logf("primary worker failed after %d restarts, switching to fallback", s.budgetUsed)
+			s.degrade()
+			return restart{}, true
+		}
+		if overBackoff {
+			s.logf("giving up after %d restarts: backing off %v would exceed MaxTotalBackoff %v", s.budgetUsed, backoff, s.cfg.MaxTotalBackoff)
+		} else {
+			s.logf("giving up after %d restarts", s.budgetUsed)
+		}
+		s.giveUp(exit, StopGaveUp)
+		return restart{}, false
+	}
 
+	state = StateBackingOff
+	if cb, ok := s.strategy.(*circuitBreaker); ok && cb.isOpen() {
+		state = StateCircuitOpen
+		s.lifecyclef("circuit open after repeated crashes")
+	}
+
+	if !warmingUp {
+		s.budgetUsed++
+		s.backedOff += backoff
+	}
+	s.mu.Lock()
+	s.addRestartLocked()
+	s.backoff = backoff
+	s.backoffAt = time.Now()
+	s.downSince = s.backoffAt
+	s.state = state
+	s.mu.Unlock()
+
+	if s.onRestart != nil {
+		s.onRestart()
+	}
+
+	if s.sampled() {
+		s.lifecyclef("restarting worker in %v", backoff)
+	}
+	cur.NextBackoff = backoff
+	cur.Cause = restartCauseOf(exit.Reason, cause)
+	s.emit(event{Event: "restart", BackoffMS: backoff.Milliseconds(), Cause: cur.Cause.String()})
+	s.observeAttempt(cur, func(ctx context.Context, o Observer, a *Attempt) { o.OnRestart(ctx, a) })
+	if s.cfg.SyncRestartLog && s.cfg.Flush != nil {
+		s.cfg.Flush()
+	}
+	return restart{wait: true, backoff: backoff}, true
+}
+
+// addRestartLocked counts a restart and wakes WaitForRestarts callers.
+// s.mu must be held.
+func (s *Supervisor) addRestartLocked() {
+	s.restarts++
+	close(s.restarted)
+	s.restarted = make(chan struct{})
+}
+
+// endDowntimeLocked ends the wait for a restart, if one is in progress,
+// adding it to the downtime. s.mu must be held.
+func (s *Supervisor) endDowntimeLocked(now time.Time) {
+	if !s.downSince.IsZero() {
+		s.downtime += now.Sub(s.downSince)
+		s.downSince = time.Time{}
+	}
+}
+
+// degrade switches to the fallback worker with a fresh backoff and
+// restart budget. The switch counts as a restart.
+func (s *Supervisor) degrade() {
+	s.budgetUsed, s.backedOff = 0, 0
+	strategy := bindBackoff(s.cfg)
+	if _, ok := s.scheduler.(defaultScheduler); ok {
+		s.scheduler = defaultScheduler{cfg: s.cfg, strategy: strategy}
+	}
+
+	s.mu.Lock()
+	s.strategy = strategy // stateLocked reads it from other goroutines
+	s.degraded = true
+	s.addRestartLocked()
+	s.mu.Unlock()
+	s.emit(event{Event: "fallback"})
+}
+
+// FirstError returns a channel that delivers the outcome of the worker's
+// first run, once, and is then closed: nil if the run called Ready or
+// returned cleanly, the run's error (a *PanicError or, for StartFunc, the
+// error it returned) if it failed first, or ErrStopped if the supervisor
+// stopped before a first run ended. Supervision carries on either way; a
+// caller can use it to go on with startup only if the worker did not fail
+// straight away.
+func (s *Supervisor) FirstError() <-chan error {
+	return s.firstError
+}
+
+// FirstStable returns a channel that is closed the first time a run of the
+// worker has stayed up for Config.StableThreshold, showing that the service
+// actually runs rather than just that it started. Unlike Ready, which the
+// worker asserts itself, it needs nothing from the worker. It is never
+// closed if StableThreshold is unset.
+func (s *Supervisor) FirstStable() <-chan struct{} {
+	return s.firstStable
+}
+
+// Degraded reports whether a supervisor started with StartWithFallback
+// has switched to its fallback worker.
+func (s *Supervisor) Degraded() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.degraded
+}
+
+// giveUp records that the supervisor is stopping for good because of the
+// run described by exit, and calls OnGiveUp.
+func (s *Supervisor) giveUp(exit ExitInfo, reason StopReason) {
+	s.mu.Lock()
+	s.state = StateGaveUp
+	s.stopReason = reason
+	s.err = &GaveUpError{
+		Restarts: s.budgetUsed,
+		Last:     exit.Err,
+		Panics:   slices.Clone(s.panics),
+	}
+	s.mu.Unlock()
+
+	s.emit(event{Event: "giveup"})
+	lastErr := giveUpValue(exit.Err)
+	s.observe(func(_ context.Context, o Observer) { o.OnGiveUp(lastErr) })
+	if s.onGiveUp != nil {
+		s.onGiveUp()
+	}
+}
+
+// runIsolated calls runOnce in a goroutine of its own, so that a worker
+// calling runtime.Goexit ends only its run rather than the supervisor.
+// Such a run fails with ErrGoexit, and a run that AbandonTimeout gives up
+// on fails with ErrAbandoned. With DisableRecover the run stays in the
+// supervisor's goroutine, so that a panic propagates from there.
+func (s *Supervisor) runIsolated(release func()) (err, cause error) {
+	active := newSections()
+	if s.cfg.DisableRecover {
+		return s.runOnce(release, nil, active)
+	}
+
+	done := make(chan struct{})
+	idled := make(chan struct{})
+	var runErr, runCause error
+	returned := false
 	go func() {
-		backoff := cfg.MinBackoff
+		defer close(done)
+		runErr, runCause = s.runOnce(release, idled, active)
+		returned = true
+	}()
 
+	select {
+	case <-done:
+	case <-idled:
+		if s.cfg.AbandonTimeout <= 0 {
+			<-done
+			break
+		}
+	wait:
 		for {
 			select {
-			case <-ctx.Done():
-				cfg.Logger.Println("[supervisor] stopped")
-				return
+			case <-done:
+				break wait
+			case <-s.cfg.After(s.cfg.AbandonTimeout):
+			}
+			// Give a unit in progress time to finish, and the worker
+			// another AbandonTimeout to return after it.
+			if s.waitSections(active, done) {
+				continue
+			}
+			select {
+			case <-done:
+				break wait
 			default:
 			}
+			s.logf("worker did not return %v after going idle, abandoning it", s.cfg.AbandonTimeout)
+			return ErrAbandoned, ErrIdle
+		}
+	}
 
-			func() {
-				defer func() {
-					if r := recover(); r != nil {
-						cfg.Logger.Printf("[supervisor] worker crashed: %v", r)
-					}
-				}()
+	if !returned {
+		if s.sampled() {
+			s.logf("worker exited via runtime.Goexit")
+		}
+		return ErrGoexit, nil
+	}
+	return runErr, runCause
+}
 
-				worker(ctx)
-			}()
+// runOnce runs the worker a single time, recovering any panic. It returns
+// the error the run ended with (a *PanicError if it panicked) and the
+// cause if the supervisor cancelled the run itself (for example ErrIdle).
+func (s *Supervisor) runOnce(release func(), idled chan<- struct{}, active *sections) (err, cause error) {
+	ctx, cancel := context.WithCancelCause(s.ctx)
+	defer cancel(nil)
+	s.mu.Lock()
+	s.runCancel = cancel
+	s.mu.Unlock()
 
-			cfg.Logger.Printf("[supervisor] restarting worker in %v", backoff)
-			time.Sleep(backoff)
+	timeout := s.cfg.RunTimeout
+	if s.cfg.RunDeadlineFunc != nil {
+		timeout = s.cfg.RunDeadlineFunc(s.currentAttempt())
+	}
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeoutCause(ctx, timeout, ErrRunTimeout)
+		defer cancelTimeout()
+	}
 
-			// exponential backoff
-			backoff = time.Duration(math.Min(float64(backoff*2), float64(cfg.MaxBackoff)))
+	ctx = context.WithValue(ctx, heartbeatKey{}, s.beat)
+	ctx = context.WithValue(ctx, lastExitKey{}, s.lastExit)
+	registry := &cleanups{}
+	ctx = context.WithValue(ctx, cleanupKey{}, registry)
+	var restartRequested atomic.Bool
+	ctx = context.WithValue(ctx, restartKey{}, &restartRequested)
+	ready := func() {
+		s.markReady()
+		release()
+	}
+	ctx = context.WithValue(ctx, readyKey{}, ready)
+	ctx = context.WithValue(ctx, sectionsKey{}, active)
+	if s.cfg.ShutdownGrace > 0 {
+		ctx = context.WithValue(ctx, shutdownGraceKey{}, s.cfg.ShutdownGrace)
+	}
+	if s.barrier != nil {
+		ctx = context.WithValue(ctx, barrierKey{}, s.barrier)
+	}
+	if s.tokens != nil {
+		ctx = context.WithValue(ctx, tokenKey{}, s.tokens)
+	}
+	if s.cfg.IdleTimeout > 0 {
+		go s.watchIdle(ctx, cancel, idled, active)
+	}
+	if s.cfg.ResourceProbe != nil || s.memoryGuarded() {
+		go s.watchResources(ctx, cancel)
+	}
+	if s.cfg.RestartSignal != nil {
+		go s.watchRestartSignal(ctx, cancel)
+	}
+	if s.cfg.StableThreshold > 0 && !s.isStable() {
+		go s.watchStable(ctx)
+	}
+
+	var called time.Time
+	defer func() {
+		var r any
+		if !s.cfg.DisableRecover {
+			r = recover()
 		}
+		if r != nil {
+			pe := &PanicError{Value: r, Duration: time.Since(called), format: s.cfg.FormatPanic}
+			if s.cfg.CaptureStack {
+				pe.Stack = truncateStack(debug.Stack(), s.cfg.MaxStackBytes)
+			}
+			if s.sampled() {
+				crashed := "worker crashed"
+				if s.cfg.LogRunDuration {
+					crashed = fmt.Sprintf("worker crashed after %v", pe.Duration.Round(time.Millisecond))
+				}
+				if pe.Stack != nil {
+					s.logf("%s: %s\n%s\n", crashed, s.cfg.FormatPanic(r), pe.Stack)
+				} else {
+					s.logf("%s: %s", crashed, s.cfg.FormatPanic(r))
+				}
+			}
+			err = pe
+		}
+		if ctx.Err() != nil && s.ctx.Err() == nil {
+			cause = context.Cause(ctx)
+		}
+		registry.run(s)
 	}()
+
+	if s.cfg.StartWindow > 0 {
+		defer time.AfterFunc(s.cfg.StartWindow, release).Stop()
+	} else {
+		release()
+	}
+	called = time.Now()
+	if err := s.callWorker(ctx); err != nil {
+		if err == errDrain {
+			s.Drain()
+			return nil, nil
+		}
+		var pe *PanicError
+		if errors.As(err, &pe) && pe.format == nil {
+			pe.format = s.cfg.FormatPanic
+		}
+		if s.sampled() {
+			s.logf("worker failed: %v", err)
+		}
+		return err, nil
+	}
+	if restartRequested.Load() {
+		return nil, ErrRestartRequested
+	}
+	return nil, nil
+}
+
+// startHook calls Config.OnStart, if set, for the given attempt and
+// returns its error.
+func (s *Supervisor) startHook(attempt int) error {
+	if s.cfg.OnStart == nil {
+		return nil
+	}
+	ctx := context.WithValue(s.ctx, asyncKey{}, s)
+	if s.cfg.HookTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.HookTimeout)
+		defer cancel()
+	}
+	err := s.cfg.OnStart(ctx, attempt)
+	if err != nil && s.sampled() {
+		s.logf("OnStart failed, not running worker: %v", err)
+	}
+	return err
+}
+
+// callHook runs a hook with a context bounded by HookTimeout, returning
+// once the hook does or the timeout elapses.
+func (s *Supervisor) callHook(hook func(ctx context.Context)) {
+	if s.hookSlots != nil {
+		if !s.acquireHookSlot() {
+			return
+		}
+		run := hook
+		hook = func(ctx context.Context) {
+			defer func() { <-s.hookSlots }()
+			run(ctx)
+		}
+	}
+
+	ctx := context.WithValue(s.ctx, asyncKey{}, s)
+	if s.cfg.HookTimeout <= 0 {
+		hook(ctx)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.HookTimeout)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer cancel()
+		defer func() {
+			if s.cfg.DisableRecover {
+				return
+			}
+			if r := recover(); r != nil {
+				// As if the hook had panicked in the supervisor goroutine.
+				s.internalPanic(r)
+				s.cancel()
+			}
+		}()
+		hook(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-s.cfg.After(s.cfg.HookTimeout):
+		cancel()
+		s.logf("hook timed out")
+	}
+}
+
+// acquireHookSlot waits for one of the group's hook slots, reporting
+// false if the hook should be skipped: because HookTimeout elapsed first,
+// or because the supervisor was stopped while the hook was queued. Hooks
+// called once the supervisor is stopping, such as OnStop, are not skipped
+// for that reason.
+func (s *Supervisor) acquireHookSlot() bool {
+	select {
+	case s.hookSlots <- struct{}{}:
+		return true
+	default:
+	}
+
+	var stopped <-chan struct{}
+	if s.ctx.Err() == nil {
+		stopped = s.ctx.Done()
+	}
+	var timeout <-chan time.Time
+	if s.cfg.HookTimeout > 0 {
+		timeout = s.cfg.After(s.cfg.HookTimeout)
+	}
+
+	select {
+	case s.hookSlots <- struct{}{}:
+		return true
+	case <-stopped:
+		s.logf("hook skipped, supervisor stopped while it was queued")
+	case <-timeout:
+		s.logf("hook timed out waiting for a slot")
+	}
+	return false
+}
+
+// callWorker invokes the worker, or the fallback once degraded, under
+// pprof goroutine labels if enabled.
+func (s *Supervisor) callWorker(ctx context.Context) (err error) {
+	s.mu.Lock()
+	worker := s.worker
+	s.mu.Unlock()
+	if s.degraded {
+		worker = s.fallback
+	}
+	if !s.cfg.PprofLabels {
+		return worker(ctx)
+	}
+
+	name := s.cfg.Name
+	if name == "" {
+		name = s.cfg.RunID
+	}
+	labels := pprof.Labels("supervisor", name, "run", s.cfg.RunID, "attempt", strconv.Itoa(s.currentAttempt()))
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		err = worker(ctx)
+	})
+	return err
+}
+
+// watchIdle cancels the run with ErrIdle if no heartbeat arrives within
+// IdleTimeout, then closes idled if it is not nil. It returns when the
+// run's context is done.
+func (s *Supervisor) watchIdle(ctx context.Context, cancel context.CancelCauseFunc, idled chan<- struct{}, active *sections) {
+	timeout := s.cfg.After(s.cfg.IdleTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.beat:
+			timeout = s.cfg.After(s.cfg.IdleTimeout)
+		case <-timeout:
+			// A unit in progress counts as activity until it ends.
+			if s.waitSections(active, ctx.Done()) {
+				timeout = s.cfg.After(s.cfg.IdleTimeout)
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			cancel(ErrIdle)
+			if idled != nil {
+				close(idled)
+			}
+			return
+		}
+	}
+}
+
+// watchResources polls ResourceProbe and MemoryProbe and cancels the run
+// with ErrResourceLimit or ErrMemoryLimit once either asks for a restart.
+// It returns when the run's context is done.
+func (s *Supervisor) watchResources(ctx context.Context, cancel context.CancelCauseFunc) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.cfg.After(s.cfg.ResourceProbeInterval):
+		}
+		if s.cfg.ResourceProbe != nil && s.probe(func() bool { return s.cfg.ResourceProbe(ctx) }) {
+			cancel(ErrResourceLimit)
+			return
+		}
+		if s.memoryGuarded() && s.probe(func() bool { return s.cfg.MemoryProbe() > s.cfg.MemoryLimit }) {
+			cancel(ErrMemoryLimit)
+			return
+		}
+	}
+}
+
+// probe runs one check for watchResources, which has nothing above it to
+// recover a panic. A check that panics is logged and reports no restart.
+func (s *Supervisor) probe(check func() bool) (restart bool) {
+	defer func() {
+		if s.cfg.DisableRecover {
+			return
+		}
+		if r := recover(); r != nil {
+			s.logf("resource probe panicked: %s", s.cfg.FormatPanic(r))
+			restart = false
+		}
+	}()
+	return check()
+}
+
+// memoryGuarded reports whether MemoryProbe and MemoryLimit are both set.
+func (s *Supervisor) memoryGuarded() bool {
+	return s.cfg.MemoryProbe != nil && s.cfg.MemoryLimit > 0
+}
+
+// watchRestartSignal cancels the run when RestartSignal fires.
+func (s *Supervisor) watchRestartSignal(ctx context.Context, cancel context.CancelCauseFunc) {
+	select {
+	case <-ctx.Done():
+	case <-s.cfg.RestartSignal:
+		cancel(ErrConfigChanged)
+	}
+}
+
+// watchStable closes firstStable if the run is still going after
+// StableThreshold.
+func (s *Supervisor) watchStable(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-s.cfg.After(s.cfg.StableThreshold):
+		if ctx.Err() == nil {
+			s.stableOnce.Do(func() { close(s.firstStable) })
+		}
+	}
+}
+
+func (s *Supervisor) isStable() bool {
+	select {
+	case <-s.firstStable:
+		return true
+	default:
+		return false
+	}
+}
+
+// errOverloaded is why a restart is held by LoadGate.
+var errOverloaded = errors.New("host overloaded")
+
+// waitGate holds a restart until LoadGate and RestartGate allow it,
+// retrying every RestartGateInterval, or until the supervisor is stopped
+// or drained.
+func (s *Supervisor) waitGate() {
+	if s.cfg.RestartGate == nil && s.cfg.LoadGate == nil {
+		return
+	}
+
+	for i := 0; !s.stopping(); i++ {
+		err := s.checkGates()
+		if err == nil {
+			return
+		}
+		if i == 0 {
+			s.lifecyclef("restart held by gate: %v", err)
+		}
+		s.sleep(s.cfg.RestartGateInterval)
+	}
+}
+
+// checkGates returns why the restart is held, or nil if it may proceed.
+func (s *Supervisor) checkGates() error {
+	if s.cfg.LoadGate != nil && s.cfg.LoadGate() {
+		return errOverloaded
+	}
+	if s.cfg.RestartGate != nil {
+		return s.cfg.RestartGate(s.ctx)
+	}
+	return nil
+}
+
+// logRelaunch logs, with SyncRestartLog, that the backoff is over and the
+// worker is about to run again.
+func (s *Supervisor) logRelaunch() {
+	if !s.cfg.SyncRestartLog || s.stopping() || !s.sampled() {
+		return
+	}
+	s.mu.Lock()
+	waited := time.Since(s.backoffAt)
+	s.mu.Unlock()
+	s.lifecyclef("relaunching worker after %v", waited)
+}
+
+// stopping reports whether the supervisor has been stopped or drained.
+func (s *Supervisor) stopping() bool {
+	select {
+	case <-s.ctx.Done():
+		return true
+	case <-s.drain:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitResume blocks an idle supervisor until Resume is called or the
+// supervisor is stopped or drained.
+func (s *Supervisor) waitResume() {
+	select {
+	case <-s.resume:
+	case <-s.ctx.Done():
+	case <-s.drain:
+	}
+}
+
+// sleep waits for d, returning early if the supervisor is stopped or
+// drained in the meantime.
+func (s *Supervisor) sleep(d time.Duration) {
+	select {
+	case <-s.cfg.After(d):
+	case <-s.ctx.Done():
+	case <-s.drain:
+	}
+}
+
+// sampled reports whether the current attempt's crash and restart lines
+// should be logged, according to LogSampler.
+func (s *Supervisor) sampled() bool {
+	return s.cfg.LogSampler == nil || s.cfg.LogSampler(s.currentAttempt())
+}
+
+func (s *Supervisor) currentAttempt() int {
+	return int(s.attempt.Load())
+}
+
+// logf logs a supervisor message tagged with the run id and attempt.
+func (s *Supervisor) logf(format string, args ...any) {
+	args = append(args, s.cfg.RunID, s.currentAttempt())
+	s.cfg.Logger.Printf("[supervisor] "+format+" run=%s attempt=%d", args...)
+}
+
+// lifecyclef logs a lifecycle line, such as a restart, at most once per
+// MinLogInterval. Lines dropped in between are counted, and the count is
+// logged before the next line that gets through.
+func (s *Supervisor) lifecyclef(format string, args ...any) {
+	if s.cfg.MinLogInterval > 0 {
+		now := time.Now()
+		if !s.lastLogged.IsZero() && now.Sub(s.lastLogged) < s.cfg.MinLogInterval {
+			s.suppressed++
+			return
+		}
+		s.lastLogged = now
+		s.flushSuppressed()
+	}
+	s.logf(format, args...)
+}
+
+// flushSuppressed logs how many lines lifecyclef dropped, if any.
+func (s *Supervisor) flushSuppressed() {
+	if s.suppressed > 0 {
+		s.logf("suppressed %d lifecycle log lines", s.suppressed)
+		s.suppressed = 0
+	}
+}
+
+// truncateStack cuts stack down to max bytes, if max is positive.
+func truncateStack(stack []byte, max int) []byte {
+	if max <= 0 || len(stack) <= max {
+		return stack
+	}
+	return append(stack[:max:max], "...(truncated)"...)
+}
+
+// newRunID returns a short random hex id for tagging log lines.
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
 }
@@ -1,15 +1,23 @@
 package supervisor
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"runtime/pprof"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 // helper logger that writes nowhere
-var discardLogger = log.New(nil, "", 0)
+var discardLogger = log.New(io.Discard, "", 0)
 
 // Test that the worker runs at least once.
 func TestSupervisorRunsWorker(t *testing.T) {
@@ -102,6 +110,46 @@ func TestSupervisorStopsOnCancel(t *testing.T) {
 	// nothing to assert — test passes if it does not hang
 }
 
+// Test that cancelling during a slow first run stops the supervisor once
+// the run returns, without a restart or backoff.
+func TestSupervisorCancelDuringSlowStart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var out syncBuffer
+	started := make(chan struct{})
+	runs := 0
+
+	s := Start(ctx, Config{
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+		Logger:     log.New(&out, "", 0),
+	}, func(ctx context.Context) {
+		runs++
+		close(started)
+		time.Sleep(30 * time.Millisecond) // initializing, not yet watching ctx
+	})
+
+	<-started
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("supervisor did not stop after the first run returned")
+	}
+
+	if runs != 1 || s.RestartCount() != 0 {
+		t.Fatalf("expected a single run and no restarts, got %d runs, %d restarts", runs, s.RestartCount())
+	}
+	if strings.Contains(out.String(), "restarting") {
+		t.Fatalf("unexpected restart log:\n%s", out.String())
+	}
+}
+
 // Test that the supervisor uses exponential backoff.
 func TestSupervisorBackoffIncreases(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
@@ -109,28 +157,118 @@ func TestSupervisorBackoffIncreases(t *testing.T) {
 
 	cfg := Config{
 		MinBackoff: 20 * time.Millisecond,
-		MaxBackoff: 200 * time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
 		Logger:     discardLogger,
 	}
 
-	var mu sync.Mutex
-	runCount := 0
+	s := Start(ctx, cfg, func(ctx context.Context) {
+		panic("boom")
+	})
 
-	Start(ctx, cfg, func(ctx context.Context) {
-		mu.Lock()
-		runCount++
-		mu.Unlock()
+	want := []time.Duration{20, 40, 80, 100, 100}
+	for i, ms := range want {
+		if err := s.WaitForRestarts(ctx, i+1); err != nil {
+			t.Fatal(err)
+		}
+		if got := s.CurrentBackoff(); got != ms*time.Millisecond {
+			t.Fatalf("restart %d: expected backoff %v, got %v", i+1, ms*time.Millisecond, got)
+		}
+	}
+}
+
+// Test that SetBackoffBounds changes the bounds of later restarts while
+// keeping the backoff's growth.
+func TestSupervisorSetBackoffBounds(t *testing.T) {
+	ms := time.Millisecond
+	after, recorded := recordBackoffs()
+	third, resume := make(chan struct{}), make(chan struct{})
+	runs := 0
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  ms,
+		MaxBackoff:  4 * ms,
+		MaxRestarts: 5,
+		After:       after,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		if runs == 3 {
+			close(third)
+			<-resume
+		}
 		panic("boom")
 	})
 
-	time.Sleep(5 * cfg.MinBackoff)
+	<-third
+	if err := s.SetBackoffBounds(10*ms, 5*ms); err == nil {
+		t.Error("expected min > max to be rejected")
+	}
+	if err := s.SetBackoffBounds(ms, time.Hour); err != nil {
+		t.Error(err)
+	}
+	close(resume)
+	s.Wait()
+
+	want := []time.Duration{ms, 2 * ms, 4 * ms, 8 * ms, 16 * ms}
+	if got := recorded(); !equalDurations(got, want) {
+		t.Fatalf("expected backoffs %v, got %v", want, got)
+	}
+	if cfg := s.Config(); cfg.MaxBackoff != time.Hour {
+		t.Fatalf("expected Config to report the new MaxBackoff, got %v", cfg.MaxBackoff)
+	}
+}
 
-	mu.Lock()
-	count := runCount
-	mu.Unlock()
+// Test that the final log line and StopReason say why the supervisor
+// stopped.
+func TestSupervisorStopReason(t *testing.T) {
+	run := func(cfg Config, worker func(context.Context)) (StopReason, string) {
+		var out syncBuffer
+		cfg.MinBackoff = time.Millisecond
+		cfg.Logger = log.New(&out, "", 0)
+		s := Start(context.Background(), cfg, worker)
+		s.Wait()
+		return s.StopReason(), out.String()
+	}
+	crash := func(ctx context.Context) { panic("boom") }
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		worker func(context.Context)
+		reason StopReason
+		log    string
+	}{
+		{"gave up", Config{MaxRestarts: 2}, crash, StopGaveUp, "stopped (gave up after 2 restarts)"},
+		{"fail fast", Config{FailFastOnFirstPanic: true}, crash, StopFatal, "stopped (fatal)"},
+		{"policy after failure", Config{RestartPolicy: RestartNever}, crash, StopFatal, "stopped (fatal)"},
+		{"completed", Config{RestartPolicy: RestartOnFailure}, func(ctx context.Context) {}, StopCompleted, "stopped (completed)"},
+	}
+	for _, tt := range tests {
+		reason, logs := run(tt.cfg, tt.worker)
+		if reason != tt.reason {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.reason, reason)
+		}
+		if !strings.Contains(logs, "[supervisor] "+tt.log) {
+			t.Errorf("%s: logs missing %q:\n%s", tt.name, tt.log, logs)
+		}
+	}
+
+	blocking := func(ctx context.Context) { <-ctx.Done() }
+	s := Start(context.Background(), Config{Logger: discardLogger}, blocking)
+	if s.StopReason() != StopNone {
+		t.Fatalf("expected StopNone while running, got %v", s.StopReason())
+	}
+	s.Stop()
+	s.Wait()
+	if s.StopReason() != StopCancelled {
+		t.Fatalf("expected StopCancelled, got %v", s.StopReason())
+	}
 
-	if count < 3 {
-		t.Fatalf("expected multiple restarts with backoff, got %d runs", count)
+	s = Start(context.Background(), Config{Logger: discardLogger}, blocking)
+	s.Drain()
+	s.Wait()
+	if s.StopReason() != StopDrained {
+		t.Fatalf("expected StopDrained, got %v", s.StopReason())
 	}
 }
 
@@ -138,13 +276,16 @@ func TestSupervisorBackoffIncreases(t *testing.T) {
 func TestWorkerReceivesContext(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	started := make(chan struct{})
 	done := make(chan bool)
 
 	Start(ctx, Config{Logger: discardLogger}, func(ctx context.Context) {
+		close(started)
 		<-ctx.Done()
 		done <- true
 	})
 
+	<-started
 	cancel()
 
 	select {
@@ -153,3 +294,1333 @@ func TestWorkerReceivesContext(t *testing.T) {
 		t.Fatal("worker did not exit after context cancel")
 	}
 }
+
+// syncBuffer is a bytes.Buffer that is safe for concurrent use, so tests
+// can capture supervisor logs while the supervisor goroutine is writing.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Test that log lines carry the run id and attempt number.
+func TestSupervisorLogsRunID(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var out syncBuffer
+	done := make(chan struct{})
+	runs := 0
+
+	Start(ctx, Config{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+		Logger:     log.New(&out, "", 0),
+		RunID:      "test-run",
+	}, func(ctx context.Context) {
+		runs++
+		if runs == 1 {
+			panic("boom")
+		}
+		close(done)
+		<-ctx.Done()
+	})
+
+	select {
+	case <-done:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("worker was not restarted")
+	}
+
+	logs := out.String()
+	for _, want := range []string{
+		"worker crashed: boom run=test-run attempt=1",
+		"restarting worker in 10ms run=test-run attempt=1",
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs missing %q:\n%s", want, logs)
+		}
+	}
+}
+
+// Test that a run id is generated when none is configured.
+func TestNewRunID(t *testing.T) {
+	a, b := newRunID(), newRunID()
+	if len(a) != 8 || a == b {
+		t.Fatalf("expected distinct 8-char run ids, got %q and %q", a, b)
+	}
+}
+
+// Test that Drain lets the current run finish and prevents restarts.
+func TestSupervisorDrain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	runCount := 0
+	started := make(chan struct{})
+	finish := make(chan struct{})
+
+	s := Start(ctx, Config{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 10 * time.Millisecond,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) {
+		mu.Lock()
+		runCount++
+		mu.Unlock()
+
+		close(started)
+		select {
+		case <-finish:
+		case <-ctx.Done():
+			t.Error("drain cancelled the worker context")
+		}
+	})
+
+	<-started
+	s.Drain()
+	close(finish)
+
+	waited := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Wait did not return after drained run finished")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runCount != 1 {
+		t.Fatalf("expected exactly one run after drain, got %d", runCount)
+	}
+}
+
+// Test that Stop cancels the worker and Wait returns.
+func TestSupervisorStopAndWait(t *testing.T) {
+	s := Start(context.Background(), Config{Logger: discardLogger}, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+
+	s.Stop()
+
+	waited := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("Wait did not return after Stop")
+	}
+}
+
+// Test that backoff waits go through Config.After.
+func TestSupervisorUsesAfter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tick := make(chan time.Time)
+	waits := make(chan time.Duration, 10)
+	runs := make(chan struct{}, 10)
+
+	Start(ctx, Config{
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+		Logger:     discardLogger,
+		After: func(d time.Duration) <-chan time.Time {
+			waits <- d
+			return tick
+		},
+	}, func(ctx context.Context) {
+		runs <- struct{}{}
+		panic("boom")
+	})
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case <-runs:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("run %d did not happen", i)
+		}
+		if d := <-waits; d != time.Hour {
+			t.Fatalf("expected a %v backoff, got %v", time.Hour, d)
+		}
+		if len(runs) != 0 {
+			t.Fatal("worker restarted before the backoff elapsed")
+		}
+		tick <- time.Now()
+	}
+}
+
+// Test that the supervisor gives up after MaxRestarts and calls OnGiveUp.
+func TestSupervisorGivesUp(t *testing.T) {
+	var mu sync.Mutex
+	runCount := 0
+	gaveUp := make(chan any, 1)
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		Logger:      discardLogger,
+		MaxRestarts: 2,
+		OnGiveUp:    func(lastErr any) { gaveUp <- lastErr },
+	}, func(ctx context.Context) {
+		mu.Lock()
+		runCount++
+		mu.Unlock()
+		panic("boom")
+	})
+
+	select {
+	case v := <-gaveUp:
+		if v != "boom" {
+			t.Fatalf("expected last panic value %q, got %v", "boom", v)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("supervisor did not give up")
+	}
+
+	s.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runCount != 3 {
+		t.Fatalf("expected 3 runs (1 + 2 restarts), got %d", runCount)
+	}
+}
+
+// Test that captured stacks are logged and truncated to MaxStackBytes.
+func TestSupervisorCaptureStack(t *testing.T) {
+	var out syncBuffer
+	s := Start(context.Background(), Config{
+		Logger:        log.New(&out, "", 0),
+		CaptureStack:  true,
+		MaxStackBytes: 64,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	defer s.Stop()
+
+	deadline := time.Now().Add(500 * time.Millisecond)
+	for !strings.Contains(out.String(), "...(truncated)") {
+		if time.Now().After(deadline) {
+			t.Fatalf("truncated stack not logged:\n%s", out.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if !strings.Contains(out.String(), "goroutine") {
+		t.Fatalf("stack trace not logged:\n%s", out.String())
+	}
+}
+
+// Test truncateStack keeps the head of the stack.
+func TestTruncateStack(t *testing.T) {
+	stack := []byte("0123456789")
+
+	if got := string(truncateStack(stack, 0)); got != "0123456789" {
+		t.Fatalf("unlimited stack was changed: %q", got)
+	}
+	if got := string(truncateStack(stack, 4)); got != "0123...(truncated)" {
+		t.Fatalf("unexpected truncated stack: %q", got)
+	}
+	if string(stack) != "0123456789" {
+		t.Fatalf("input stack was modified: %q", stack)
+	}
+}
+
+// Test that MaxAttemptsForBackoff stops the backoff from growing.
+func TestSupervisorMaxAttemptsForBackoff(t *testing.T) {
+	after, recorded := recordBackoffs()
+
+	s := Start(context.Background(), Config{
+		MinBackoff:            time.Millisecond,
+		MaxBackoff:            time.Hour,
+		MaxAttemptsForBackoff: 2,
+		MaxRestarts:           4,
+		Logger:                discardLogger,
+		After:                 after,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	waits := recorded()
+
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 2 * time.Millisecond, 2 * time.Millisecond}
+	if len(waits) != len(want) {
+		t.Fatalf("expected backoffs %v, got %v", want, waits)
+	}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("expected backoffs %v, got %v", want, waits)
+		}
+	}
+}
+
+// recordBackoffs returns an After func that records each wait and returns
+// immediately, along with a func reporting the waits recorded so far.
+func recordBackoffs() (func(d time.Duration) <-chan time.Time, func() []time.Duration) {
+	var mu sync.Mutex
+	var waits []time.Duration
+
+	after := func(d time.Duration) <-chan time.Time {
+		mu.Lock()
+		waits = append(waits, d)
+		mu.Unlock()
+		return time.After(0)
+	}
+	recorded := func() []time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]time.Duration(nil), waits...)
+	}
+	return after, recorded
+}
+
+// Test that BackoffFactor controls backoff growth and rejects values <= 1.
+func TestSupervisorBackoffFactor(t *testing.T) {
+	cases := []struct {
+		factor float64
+		want   []time.Duration
+	}{
+		{3, []time.Duration{time.Millisecond, 3 * time.Millisecond, 9 * time.Millisecond}},
+		{0.5, []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond}},
+	}
+
+	for _, c := range cases {
+		after, recorded := recordBackoffs()
+
+		var out syncBuffer
+		s := Start(context.Background(), Config{
+			MinBackoff:    time.Millisecond,
+			MaxBackoff:    time.Hour,
+			BackoffFactor: c.factor,
+			MaxRestarts:   3,
+			Logger:        log.New(&out, "", 0),
+			After:         after,
+		}, func(ctx context.Context) {
+			panic("boom")
+		})
+		s.Wait()
+
+		got := recorded()
+		if len(got) != len(c.want) {
+			t.Fatalf("factor %v: expected backoffs %v, got %v", c.factor, c.want, got)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("factor %v: expected backoffs %v, got %v", c.factor, c.want, got)
+			}
+		}
+
+		warned := strings.Contains(out.String(), "invalid BackoffFactor")
+		if warned != (c.factor <= 1) {
+			t.Fatalf("factor %v: unexpected warning state %v:\n%s", c.factor, warned, out.String())
+		}
+	}
+}
+
+// Test that PprofLabels labels the worker's goroutine.
+func TestSupervisorPprofLabels(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	labels := make(chan [2]string, 1)
+
+	Start(ctx, Config{
+		Name:        "labelled",
+		Logger:      discardLogger,
+		PprofLabels: true,
+	}, func(ctx context.Context) {
+		name, _ := pprof.Label(ctx, "supervisor")
+		attempt, _ := pprof.Label(ctx, "attempt")
+		labels <- [2]string{name, attempt}
+		<-ctx.Done()
+	})
+
+	select {
+	case got := <-labels:
+		if got != [2]string{"labelled", "1"} {
+			t.Fatalf("unexpected labels %v", got)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("worker did not run")
+	}
+}
+
+// Test that Clone starts a fresh supervisor with the same worker.
+func TestSupervisorClone(t *testing.T) {
+	var mu sync.Mutex
+	runCount := 0
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		mu.Lock()
+		runCount++
+		mu.Unlock()
+		panic("boom")
+	})
+	s.Wait()
+
+	c := s.Clone(context.Background())
+	c.Wait()
+
+	if st := c.State(); st != StateGaveUp {
+		t.Fatalf("expected clone to give up, got %v", st)
+	}
+	if c.cfg.RunID == s.cfg.RunID {
+		t.Fatal("expected clone to get a new run id")
+	}
+	if s.RestartCount() != 1 || c.RestartCount() != 1 {
+		t.Fatalf("expected 1 restart each, got %d and %d", s.RestartCount(), c.RestartCount())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runCount != 4 {
+		t.Fatalf("expected 4 runs across both supervisors, got %d", runCount)
+	}
+}
+
+// Test that RunDeadlineFunc bounds each run and expiry triggers a restart.
+func TestSupervisorRunDeadlineFunc(t *testing.T) {
+	var mu sync.Mutex
+	var lived []time.Duration
+	var causes []error
+
+	s := Start(context.Background(), Config{
+		MinBackoff:      time.Millisecond,
+		MaxRestarts:     2,
+		Logger:          discardLogger,
+		RunDeadlineFunc: func(attempt int) time.Duration { return time.Duration(attempt) * 20 * time.Millisecond },
+	}, func(ctx context.Context) {
+		start := time.Now()
+		<-ctx.Done()
+
+		mu.Lock()
+		lived = append(lived, time.Since(start))
+		causes = append(causes, context.Cause(ctx))
+		mu.Unlock()
+	})
+	s.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(lived) != 3 {
+		t.Fatalf("expected 3 runs, got %d", len(lived))
+	}
+	for i, d := range lived {
+		want := time.Duration(i+1) * 20 * time.Millisecond
+		if d < want {
+			t.Errorf("run %d lived %v, expected at least %v", i+1, d, want)
+		}
+		if causes[i] != ErrRunTimeout {
+			t.Errorf("run %d cancelled with %v, expected ErrRunTimeout", i+1, causes[i])
+		}
+	}
+}
+
+// Test that Config reports the defaults a supervisor was started with.
+func TestSupervisorConfig(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := Start(ctx, Config{MaxBackoff: time.Minute, BackoffFactor: 1, Logger: discardLogger}, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+
+	cfg := s.Config()
+	if cfg.MinBackoff != time.Second || cfg.MaxBackoff != time.Minute {
+		t.Fatalf("expected backoff [1s, 1m], got [%v, %v]", cfg.MinBackoff, cfg.MaxBackoff)
+	}
+	if cfg.BackoffFactor != 2 {
+		t.Fatalf("expected invalid BackoffFactor to be replaced by 2, got %v", cfg.BackoffFactor)
+	}
+}
+
+// Test that invalid values are replaced rather than used, so that they
+// cannot spin the supervisor in a hot loop.
+func TestSupervisorConfigReplacesInvalid(t *testing.T) {
+	var probes atomic.Int32
+
+	s := Start(context.Background(), Config{
+		MinBackoff:            -time.Second,
+		MaxBackoff:            -time.Second,
+		RestartGateInterval:   -time.Second,
+		ResourceProbeInterval: -time.Second,
+		MaxRestarts:           -1,
+		Jitter:                2,
+		JitterMode:            -1,
+		Logger:                discardLogger,
+		ResourceProbe: func(ctx context.Context) bool {
+			probes.Add(1)
+			return false
+		},
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	time.Sleep(50 * time.Millisecond)
+	s.Stop()
+
+	cfg := s.Config()
+	if cfg.MinBackoff != time.Second || cfg.MaxBackoff != 30*time.Second {
+		t.Fatalf("expected backoff [1s, 30s], got [%v, %v]", cfg.MinBackoff, cfg.MaxBackoff)
+	}
+	if cfg.RestartGateInterval != time.Second || cfg.ResourceProbeInterval != 10*time.Second {
+		t.Fatalf("expected default intervals, got %v and %v", cfg.RestartGateInterval, cfg.ResourceProbeInterval)
+	}
+	if cfg.MaxRestarts != 0 || cfg.Jitter != 1 || cfg.JitterMode != JitterProportional {
+		t.Fatalf("expected MaxRestarts, Jitter and JitterMode brought into range, got %d, %v and %v", cfg.MaxRestarts, cfg.Jitter, cfg.JitterMode)
+	}
+	if n := s.RestartCount(); n > 1 || probes.Load() != 0 {
+		t.Fatalf("expected at most 1 restart and no probes, got %d and %d", n, probes.Load())
+	}
+}
+
+// Test that a MinBackoff above MaxBackoff raises MaxBackoff to match.
+func TestSupervisorConfigMinAboveMax(t *testing.T) {
+	s := Start(context.Background(), Config{MinBackoff: time.Minute, MaxBackoff: time.Second, Logger: discardLogger}, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	defer s.Stop()
+
+	if cfg := s.Config(); cfg.MinBackoff != time.Minute || cfg.MaxBackoff != time.Minute {
+		t.Fatalf("expected backoff [1m, 1m], got [%v, %v]", cfg.MinBackoff, cfg.MaxBackoff)
+	}
+}
+
+// Test that ResourceProbe triggers preventive restarts outside the budget.
+func TestSupervisorResourceProbe(t *testing.T) {
+	var mu sync.Mutex
+	probes := 0
+	runs := make(chan error, 10)
+
+	s := Start(context.Background(), Config{
+		MinBackoff:            time.Hour,
+		MaxRestarts:           1,
+		ResourceProbeInterval: 5 * time.Millisecond,
+		Logger:                discardLogger,
+		ResourceProbe: func(ctx context.Context) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			probes++
+			return probes%2 == 0
+		},
+	}, func(ctx context.Context) {
+		<-ctx.Done()
+		runs <- context.Cause(ctx)
+	})
+	defer s.Stop()
+
+	for i := 1; i <= 3; i++ {
+		select {
+		case cause := <-runs:
+			if cause != ErrResourceLimit {
+				t.Fatalf("run %d cancelled with %v, expected ErrResourceLimit", i, cause)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("run %d was not restarted by the probe", i)
+		}
+	}
+
+	if st := s.State(); st == StateGaveUp {
+		t.Fatal("preventive restarts consumed the restart budget")
+	}
+}
+
+// Test that a ResourceProbe or MemoryProbe that panics is logged and
+// leaves the run alone.
+func TestSupervisorResourceProbePanics(t *testing.T) {
+	var out syncBuffer
+	var probes atomic.Int32
+
+	s := Start(context.Background(), Config{
+		ResourceProbeInterval: time.Millisecond,
+		Logger:                log.New(&out, "", 0),
+		ResourceProbe: func(ctx context.Context) bool {
+			probes.Add(1)
+			panic("probe bug")
+		},
+		MemoryLimit: 100,
+		MemoryProbe: func() uint64 { panic("memory probe bug") },
+	}, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	defer s.Stop()
+
+	for probes.Load() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	if n := s.RestartCount(); n != 0 {
+		t.Fatalf("expected no restarts, got %d", n)
+	}
+	for _, want := range []string{"resource probe panicked: probe bug", "resource probe panicked: memory probe bug"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("logs missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// Test that MemoryProbe restarts the worker once it exceeds MemoryLimit,
+// without using up the restart budget.
+func TestSupervisorMemoryLimit(t *testing.T) {
+	var used atomic.Uint64
+	runs := make(chan error, 10)
+
+	s := Start(context.Background(), Config{
+		MinBackoff:            time.Hour,
+		MaxRestarts:           1,
+		ResourceProbeInterval: 5 * time.Millisecond,
+		MemoryLimit:           100,
+		MemoryProbe:           used.Load,
+		Logger:                discardLogger,
+	}, func(ctx context.Context) {
+		used.Store(0)
+		<-ctx.Done()
+		runs <- context.Cause(ctx)
+	})
+	defer s.Stop()
+
+	for i := 1; i <= 2; i++ {
+		time.Sleep(20 * time.Millisecond)
+		select {
+		case cause := <-runs:
+			t.Fatalf("run %d cancelled with %v below the limit", i, cause)
+		default:
+		}
+		used.Store(101)
+		select {
+		case cause := <-runs:
+			if cause != ErrMemoryLimit {
+				t.Fatalf("run %d cancelled with %v, expected ErrMemoryLimit", i, cause)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("run %d was not restarted above the limit", i)
+		}
+	}
+
+	if st := s.State(); st == StateGaveUp {
+		t.Fatal("memory restarts consumed the restart budget")
+	}
+}
+
+// Test that RestartSignal restarts the running worker without backoff or
+// using up the restart budget.
+func TestSupervisorRestartSignal(t *testing.T) {
+	signal := make(chan struct{})
+	runs := make(chan error, 10)
+
+	s := Start(context.Background(), Config{
+		MinBackoff:    time.Hour,
+		MaxRestarts:   1,
+		RestartSignal: signal,
+		Logger:        discardLogger,
+	}, func(ctx context.Context) {
+		runs <- nil
+		<-ctx.Done()
+		runs <- context.Cause(ctx)
+	})
+	defer s.Stop()
+
+	<-runs
+	for i := 1; i <= 2; i++ {
+		signal <- struct{}{}
+		if cause := <-runs; cause != ErrConfigChanged {
+			t.Fatalf("run %d cancelled with %v, expected ErrConfigChanged", i, cause)
+		}
+		select {
+		case <-runs:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("run %d was not restarted by the signal", i)
+		}
+	}
+
+	if n := s.RestartCount(); n != 2 {
+		t.Fatalf("expected 2 restarts, got %d", n)
+	}
+}
+
+// Test that RestartGate holds restarts until it returns nil.
+func TestSupervisorRestartGate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	open := false
+	checks := 0
+	runs := make(chan struct{}, 10)
+
+	Start(ctx, Config{
+		MinBackoff:          time.Millisecond,
+		RestartGateInterval: time.Millisecond,
+		Logger:              discardLogger,
+		RestartGate: func(ctx context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			checks++
+			if !open {
+				return errors.New("queue full")
+			}
+			return nil
+		},
+	}, func(ctx context.Context) {
+		runs <- struct{}{}
+		panic("boom")
+	})
+
+	<-runs
+	time.Sleep(30 * time.Millisecond)
+
+	mu.Lock()
+	if len(runs) != 0 {
+		mu.Unlock()
+		t.Fatal("worker restarted while the gate was closed")
+	}
+	if checks < 2 {
+		mu.Unlock()
+		t.Fatalf("expected the gate to be retried, got %d checks", checks)
+	}
+	open = true
+	mu.Unlock()
+
+	select {
+	case <-runs:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("worker was not restarted after the gate opened")
+	}
+}
+
+// Test that LoadGate holds restarts while the host is overloaded.
+func TestSupervisorLoadGate(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var overloaded atomic.Bool
+	overloaded.Store(true)
+	runs := make(chan struct{}, 10)
+
+	Start(ctx, Config{
+		MinBackoff:          time.Millisecond,
+		RestartGateInterval: time.Millisecond,
+		LoadGate:            overloaded.Load,
+		Logger:              discardLogger,
+	}, func(ctx context.Context) {
+		runs <- struct{}{}
+		panic("boom")
+	})
+
+	<-runs
+	time.Sleep(30 * time.Millisecond)
+	if len(runs) != 0 {
+		t.Fatal("worker restarted while the host was overloaded")
+	}
+	overloaded.Store(false)
+
+	select {
+	case <-runs:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("worker was not restarted once the load subsided")
+	}
+}
+
+// Test that StartHandoff passes each run the state the last successful
+// run returned.
+func TestStartHandoff(t *testing.T) {
+	var got []any
+	runs := 0
+
+	s := StartHandoff(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 3,
+		Logger:      discardLogger,
+	}, func(ctx context.Context, incoming any) any {
+		runs++
+		got = append(got, incoming)
+		if runs == 3 {
+			panic("boom")
+		}
+		return runs
+	})
+	s.Wait()
+
+	want := []any{nil, 1, 2, 2}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected incoming states %v, got %v", want, got)
+	}
+}
+
+// Test that StartWithFallback switches to the fallback once the primary
+// exhausts its budget, and gives up once the fallback does too.
+func TestStartWithFallback(t *testing.T) {
+	var primary, fallback int
+
+	s := StartWithFallback(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		MaxRestarts: 2,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		primary++
+		panic("primary")
+	}, func(ctx context.Context) {
+		fallback++
+		panic("fallback")
+	})
+	s.Wait()
+
+	if primary != 3 || fallback != 3 {
+		t.Fatalf("expected 3 runs of each worker, got %d primary and %d fallback", primary, fallback)
+	}
+	if !s.Degraded() {
+		t.Fatal("expected the supervisor to report it degraded")
+	}
+	var gaveUp *GaveUpError
+	if !errors.As(s.Err(), &gaveUp) || gaveUp.Restarts != 2 {
+		t.Fatalf("expected the fallback to give up after 2 restarts, got %v", s.Err())
+	}
+}
+
+// Test that switching to the fallback does not race readers of the state
+// when the backoff is a circuit breaker. Run with -race.
+func TestStartWithFallbackCircuitBreaker(t *testing.T) {
+	s := StartWithFallback(context.Background(), Config{
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		MaxRestarts: 1,
+		Logger:      discardLogger,
+		// Linger between the half-open trial's exit and the switch to
+		// the fallback, while State still reads the strategy.
+		ShouldResetBackoff: func(Attempt) bool {
+			time.Sleep(5 * time.Millisecond)
+			return false
+		},
+		Backoff: CircuitBreaker(CircuitBreakerConfig{
+			Threshold:       1,
+			Cooldown:        time.Millisecond,
+			StableThreshold: time.Hour,
+		}),
+	}, func(ctx context.Context) {
+		panic("primary")
+	}, func(ctx context.Context) {
+		panic("fallback")
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-s.done:
+				return
+			default:
+				s.State()
+				s.Status()
+			}
+		}
+	}()
+	s.Wait()
+	<-done
+
+	if !s.Degraded() {
+		t.Fatal("expected the supervisor to report it degraded")
+	}
+}
+
+// Test that FirstStable is closed once a run outlasts StableThreshold, and
+// not by runs that crash before it.
+func TestSupervisorFirstStable(t *testing.T) {
+	var runs atomic.Int32
+
+	s := Start(context.Background(), Config{
+		MinBackoff:      time.Millisecond,
+		StableThreshold: 20 * time.Millisecond,
+		Logger:          discardLogger,
+	}, func(ctx context.Context) {
+		if runs.Add(1) <= 2 {
+			time.Sleep(10 * time.Millisecond)
+			panic("boom")
+		}
+		<-ctx.Done()
+	})
+	defer s.Stop()
+
+	select {
+	case <-s.FirstStable():
+		if n := runs.Load(); n < 3 {
+			t.Fatalf("FirstStable closed during run %d, which crashed", n)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("FirstStable was not closed")
+	}
+}
+
+// Test that ReplaceWorker swaps the worker for the next run, and restarts
+// the current run at once when asked to.
+func TestSupervisorReplaceWorker(t *testing.T) {
+	runs := make(chan string, 10)
+	causes := make(chan error, 10)
+	worker := func(name string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			runs <- name
+			<-ctx.Done()
+			causes <- context.Cause(ctx)
+		}
+	}
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  time.Hour,
+		MaxRestarts: 1,
+		Logger:      discardLogger,
+	}, worker("v1"))
+	defer s.Stop()
+
+	if name := <-runs; name != "v1" {
+		t.Fatalf("expected v1 to run first, got %s", name)
+	}
+	s.ReplaceWorker(worker("v2"), true)
+	if cause := <-causes; cause != ErrWorkerReplaced {
+		t.Fatalf("expected the run to be cancelled with ErrWorkerReplaced, got %v", cause)
+	}
+	select {
+	case name := <-runs:
+		if name != "v2" {
+			t.Fatalf("expected v2 to run next, got %s", name)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("the replacement worker did not start")
+	}
+}
+
+// Test that Protect supervises inline and returns when supervision ends.
+func TestProtect(t *testing.T) {
+	runs := 0
+
+	protected := Protect(Config{
+		MinBackoff:    time.Millisecond,
+		RestartPolicy: RestartOnFailure,
+		Logger:        discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		if runs < 3 {
+			panic("boom")
+		}
+	})
+
+	protected(context.Background())
+
+	if runs != 3 {
+		t.Fatalf("expected 3 runs before returning, got %d", runs)
+	}
+}
+
+// Test that factory errors count as failed attempts and successes run.
+func TestStartFactory(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	attempts := 0
+	ran := make(chan int, 1)
+
+	s := StartFactory(ctx, Config{
+		MinBackoff: time.Millisecond,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) (func(ctx context.Context), error) {
+		attempts++
+		if attempts < 3 {
+			return nil, errors.New("dial failed")
+		}
+		n := attempts
+		return func(ctx context.Context) {
+			ran <- n
+			<-ctx.Done()
+		}, nil
+	})
+
+	select {
+	case n := <-ran:
+		if n != 3 {
+			t.Fatalf("expected the worker from attempt 3 to run, got attempt %d", n)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("worker never ran")
+	}
+
+	if r := s.RestartCount(); r != 2 {
+		t.Fatalf("expected 2 restarts after factory failures, got %d", r)
+	}
+}
+
+// Test that WaitIdle waits for the current run but not for full stop.
+func TestSupervisorWaitIdle(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s := Start(context.Background(), Config{
+		MinBackoff: time.Hour,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	defer s.Stop()
+
+	<-started
+
+	idle := make(chan struct{})
+	go func() {
+		s.WaitIdle()
+		close(idle)
+	}()
+
+	select {
+	case <-idle:
+		t.Fatal("WaitIdle returned while the worker was running")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-idle:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("WaitIdle did not return after the run finished")
+	}
+
+	// The supervisor is now backing off, so WaitIdle returns at once.
+	waitForState(t, s, StateBackingOff)
+	s.WaitIdle()
+}
+
+// Test that LogSampler gates crash and restart lines per attempt.
+func TestSupervisorLogSampler(t *testing.T) {
+	var out syncBuffer
+
+	s := Start(context.Background(), Config{
+		RunID:       "sampled",
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+		MaxRestarts: 7,
+		Logger:      log.New(&out, "", 0),
+		LogSampler:  func(attempt int) bool { return attempt&(attempt-1) == 0 },
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	logs := out.String()
+	for attempt := 1; attempt <= 8; attempt++ {
+		line := fmt.Sprintf("worker crashed: boom run=sampled attempt=%d\n", attempt)
+		logged := strings.Contains(logs, line)
+		if want := attempt&(attempt-1) == 0; logged != want {
+			t.Errorf("attempt %d: crash logged=%v, want %v", attempt, logged, want)
+		}
+	}
+	if n := strings.Count(logs, "restarting worker"); n != 3 {
+		t.Errorf("expected 3 sampled restart lines, got %d:\n%s", n, logs)
+	}
+}
+
+// Test that MinLogInterval rate-limits restart lines but not crashes, and
+// reports how many lines it dropped.
+func TestSupervisorMinLogInterval(t *testing.T) {
+	var out syncBuffer
+
+	s := Start(context.Background(), Config{
+		MinBackoff:     time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		MaxRestarts:    5,
+		MinLogInterval: time.Hour,
+		Logger:         log.New(&out, "", 0),
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	logs := out.String()
+	if n := strings.Count(logs, "worker crashed"); n != 6 {
+		t.Errorf("expected every crash to be logged, got %d:\n%s", n, logs)
+	}
+	if n := strings.Count(logs, "restarting worker"); n != 1 {
+		t.Errorf("expected 1 restart line, got %d:\n%s", n, logs)
+	}
+	if !strings.Contains(logs, "suppressed 4 lifecycle log lines") {
+		t.Errorf("expected the suppressed count to be logged:\n%s", logs)
+	}
+}
+
+// Test that FailFastOnFirstPanic stops on a first-run panic and Run
+// reports it.
+func TestRunFailFastOnFirstPanic(t *testing.T) {
+	runs := 0
+
+	err := Run(context.Background(), Config{
+		MinBackoff:           time.Hour,
+		MaxBackoff:           time.Hour,
+		FailFastOnFirstPanic: true,
+		Logger:               discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		panic("misconfigured")
+	})
+
+	if runs != 1 {
+		t.Fatalf("expected a single run, got %d", runs)
+	}
+
+	var gu *GaveUpError
+	if !errors.As(err, &gu) || gu.Restarts != 0 {
+		t.Fatalf("expected a *GaveUpError after 0 restarts, got %v", err)
+	}
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "misconfigured" {
+		t.Fatalf("expected the first-run panic, got %v", err)
+	}
+}
+
+// Test that only the first run fails fast.
+func TestFailFastOnlyOnFirstRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runs := 0
+
+	err := Run(ctx, Config{
+		MinBackoff:           time.Millisecond,
+		FailFastOnFirstPanic: true,
+		Logger:               discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		switch runs {
+		case 2:
+			panic("later")
+		case 3:
+			cancel()
+		}
+	})
+
+	if err != nil {
+		t.Fatalf("expected nil after cancel, got %v", err)
+	}
+	if runs != 3 {
+		t.Fatalf("expected the second-run panic to be restarted, got %d runs", runs)
+	}
+}
+
+// Test that restarts during WarmupPeriod do not count against MaxRestarts.
+func TestSupervisorWarmupPeriod(t *testing.T) {
+	const warmup = 50 * time.Millisecond
+	start := time.Now()
+	runs := 0
+
+	err := Run(context.Background(), Config{
+		MinBackoff:   5 * time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+		MaxRestarts:  1,
+		WarmupPeriod: warmup,
+		Logger:       discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		panic("not ready")
+	})
+
+	var gu *GaveUpError
+	if !errors.As(err, &gu) || gu.Restarts != 1 {
+		t.Fatalf("expected a give-up after 1 counted restart, got %v", err)
+	}
+	if time.Since(start) < warmup || runs < 4 {
+		t.Fatalf("expected warmup crashes to be restarted freely, gave up after %d runs", runs)
+	}
+}
+
+// Test that a nil worker panics at the call site with a clear message.
+func TestStartNilWorker(t *testing.T) {
+	cases := map[string]func(){
+		"Start":     func() { Start(context.Background(), Config{}, nil) },
+		"StartFunc": func() { StartFunc(context.Background(), Config{}, nil) },
+		"Run":       func() { Run(context.Background(), Config{}, nil) },
+		"Protect":   func() { Protect(Config{}, nil) },
+		"StartConsumer": func() {
+			StartConsumer[int](context.Background(), ConsumerConfig{}, nil, nil)
+		},
+	}
+
+	for name, start := range cases {
+		func() {
+			defer func() {
+				if r := recover(); r != "supervisor: worker must not be nil" {
+					t.Errorf("%s: expected nil-worker panic, got %v", name, r)
+				}
+			}()
+			start()
+		}()
+	}
+}
+
+// Test that the supervisor gives up as soon as the final allowed run
+// fails, without sleeping another backoff first.
+func TestSupervisorGivesUpWithoutFinalBackoff(t *testing.T) {
+	const backoff = 200 * time.Millisecond
+	start := time.Now()
+
+	s := Start(context.Background(), Config{
+		MinBackoff:  backoff,
+		MaxBackoff:  backoff,
+		MaxRestarts: 1,
+		Logger:      discardLogger,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+	s.Wait()
+
+	if elapsed := time.Since(start); elapsed >= 2*backoff {
+		t.Fatalf("expected a single backoff before giving up, took %v", elapsed)
+	}
+	if st := s.State(); st != StateGaveUp {
+		t.Fatalf("expected StateGaveUp, got %v", st)
+	}
+}
+
+// Test that MaxTotalBackoff gives up instead of starting a backoff that
+// would take the total past it.
+func TestSupervisorMaxTotalBackoff(t *testing.T) {
+	ms := time.Millisecond
+
+	// Backoffs of 10, 20 and 40ms fit in 100ms; the next one, 80ms, would
+	// not.
+	err := Run(context.Background(), Config{
+		MinBackoff:      10 * ms,
+		MaxBackoff:      time.Hour,
+		MaxTotalBackoff: 100 * ms,
+		Logger:          discardLogger,
+	}, func(ctx context.Context) {
+		panic("boom")
+	})
+
+	var gu *GaveUpError
+	if !errors.As(err, &gu) || gu.Restarts != 3 {
+		t.Fatalf("expected to give up after 3 restarts, got %v", err)
+	}
+}
+
+// Test that StartSync waits for Ready or the end of the first run, and
+// reports a first-run failure.
+func TestStartSync(t *testing.T) {
+	initialized := false
+	s, err := StartSync(context.Background(), Config{Logger: discardLogger}, func(ctx context.Context) {
+		time.Sleep(10 * time.Millisecond)
+		initialized = true
+		Ready(ctx)
+		<-ctx.Done()
+	})
+	if err != nil || !initialized {
+		t.Fatalf("expected StartSync to return after Ready, got err=%v initialized=%v", err, initialized)
+	}
+	s.Stop()
+	s.Wait()
+
+	s, err = StartSync(context.Background(), Config{
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) {
+		panic("bad config")
+	})
+	defer s.Stop()
+	var pe *PanicError
+	if !errors.As(err, &pe) || pe.Value != "bad config" {
+		t.Fatalf("expected the first-run panic, got %v", err)
+	}
+	waitForState(t, s, StateBackingOff)
+}
+
+// Test that FirstError delivers the first run's error once, or nil once
+// the first run calls Ready, and then closes.
+func TestSupervisorFirstError(t *testing.T) {
+	want := errors.New("connect failed")
+	runs := 0
+	s := StartFunc(context.Background(), Config{
+		MinBackoff: time.Millisecond,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) error {
+		runs++
+		if runs == 1 {
+			return want
+		}
+		<-ctx.Done()
+		return nil
+	})
+	if err := <-s.FirstError(); err != want {
+		t.Fatalf("expected the first run's error, got %v", err)
+	}
+	if _, ok := <-s.FirstError(); ok {
+		t.Fatal("expected FirstError to be closed after one value")
+	}
+	s.Stop()
+	s.Wait()
+
+	s = Start(context.Background(), Config{Logger: discardLogger}, func(ctx context.Context) {
+		Ready(ctx)
+		<-ctx.Done()
+	})
+	if err := <-s.FirstError(); err != nil {
+		t.Fatalf("expected nil after Ready, got %v", err)
+	}
+	s.Stop()
+	s.Wait()
+
+	s = Start(context.Background(), Config{InitialDelay: time.Hour, Logger: discardLogger}, func(ctx context.Context) {})
+	s.Stop()
+	if err := <-s.FirstError(); err != ErrStopped {
+		t.Fatalf("expected ErrStopped before any run, got %v", err)
+	}
+}
+
+// Test that RunFor runs the worker for the duration and summarizes it.
+func TestRunFor(t *testing.T) {
+	runs := 0
+	st, err := RunFor(context.Background(), Config{
+		Name:       "task",
+		MinBackoff: time.Millisecond,
+		MaxBackoff: time.Millisecond,
+		Logger:     discardLogger,
+	}, func(ctx context.Context) {
+		runs++
+		if runs <= 2 {
+			panic(fmt.Sprintf("boom %d", runs))
+		}
+		<-ctx.Done()
+	}, 50*time.Millisecond)
+
+	if err != nil {
+		t.Fatalf("expected no error after a normal stop, got %v", err)
+	}
+	if st.Name != "task" || st.State != StateStopped || st.Restarts != 2 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if want := []string{"boom 1", "boom 2"}; !slices.Equal(st.Panics, want) {
+		t.Fatalf("expected panics %q, got %q", want, st.Panics)
+	}
+}
@@ -0,0 +1,125 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Validate reports every problem with cfg at once, joined with
+// errors.Join, or nil if cfg is valid. Zero values are always valid, since
+// they select the defaults.
+//
+// Start and the other entry points validate their Config too, but only log
+// the problems they find and carry on with safe values; Run returns them
+// instead. Call Validate yourself to fail fast.
+func (c Config) Validate() error {
+	return errors.Join(c.problems()...)
+}
+
+// problems returns each problem Validate reports, in field order.
+func (c Config) problems() []error {
+	var errs []error
+
+	for _, f := range c.durations() {
+		if *f.d < 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %v: must not be negative", f.name, *f.d))
+		}
+	}
+
+	minBackoff, maxBackoff := c.MinBackoff, c.MaxBackoff
+	if minBackoff == 0 {
+		minBackoff = 1 * time.Second
+	}
+	if maxBackoff == 0 {
+		maxBackoff = 30 * time.Second
+	}
+	if minBackoff > 0 && maxBackoff > 0 && minBackoff > maxBackoff {
+		errs = append(errs, fmt.Errorf("invalid MinBackoff %v: exceeds MaxBackoff %v", minBackoff, maxBackoff))
+	}
+
+	if c.BackoffFactor != 0 && c.BackoffFactor <= 1 {
+		errs = append(errs, fmt.Errorf("invalid BackoffFactor %v: must be greater than 1", c.BackoffFactor))
+	}
+	if c.Jitter < 0 || c.Jitter > 1 {
+		errs = append(errs, fmt.Errorf("invalid Jitter %v: must be between 0 and 1", c.Jitter))
+	}
+	if c.JitterMode < JitterProportional || c.JitterMode > JitterEqual {
+		errs = append(errs, fmt.Errorf("invalid JitterMode %d", c.JitterMode))
+	}
+
+	for _, f := range c.counts() {
+		if *f.n < 0 {
+			errs = append(errs, fmt.Errorf("invalid %s %d: must not be negative", f.name, *f.n))
+		}
+	}
+
+	return errs
+}
+
+type durationField struct {
+	name string
+	d    *time.Duration
+}
+
+// durations returns c's duration fields, none of which may be negative.
+func (c *Config) durations() []durationField {
+	return []durationField{
+		{"MinBackoff", &c.MinBackoff},
+		{"MaxBackoff", &c.MaxBackoff},
+		{"BackoffDecay", &c.BackoffDecay},
+		{"InitialDelay", &c.InitialDelay},
+		{"MinRunDuration", &c.MinRunDuration},
+		{"MaxTotalBackoff", &c.MaxTotalBackoff},
+		{"WarmupPeriod", &c.WarmupPeriod},
+		{"StableThreshold", &c.StableThreshold},
+		{"RespectDeadlineGrace", &c.RespectDeadlineGrace},
+		{"MinLogInterval", &c.MinLogInterval},
+		{"AbandonTimeout", &c.AbandonTimeout},
+		{"MaxUninterruptible", &c.MaxUninterruptible},
+		{"HookTimeout", &c.HookTimeout},
+		{"ShutdownTimeout", &c.ShutdownTimeout},
+		{"ShutdownGrace", &c.ShutdownGrace},
+		{"RunTimeout", &c.RunTimeout},
+		{"ResourceProbeInterval", &c.ResourceProbeInterval},
+		{"RestartGateInterval", &c.RestartGateInterval},
+		{"StartWindow", &c.StartWindow},
+		{"IdleTimeout", &c.IdleTimeout},
+	}
+}
+
+type countField struct {
+	name string
+	n    *int
+}
+
+// counts returns c's count fields, none of which may be negative.
+func (c *Config) counts() []countField {
+	return []countField{
+		{"MaxRestarts", &c.MaxRestarts},
+		{"MaxAttemptsForBackoff", &c.MaxAttemptsForBackoff},
+		{"MaxStackBytes", &c.MaxStackBytes},
+	}
+}
+
+// sanitize replaces the values problems reports as invalid: negative
+// durations and counts become zero, selecting their defaults, and Jitter
+// and JitterMode are brought back into range. A MinBackoff above
+// MaxBackoff is left to newSupervisor, which needs the defaults applied
+// first.
+func (c *Config) sanitize() {
+	for _, f := range c.durations() {
+		if *f.d < 0 {
+			*f.d = 0
+		}
+	}
+	for _, f := range c.counts() {
+		if *f.n < 0 {
+			*f.n = 0
+		}
+	}
+	c.Jitter = min(max(c.Jitter, 0), 1)
+	if c.JitterMode < JitterProportional || c.JitterMode > JitterEqual {
+		c.JitterMode = JitterProportional
+	}
+}
@@ -0,0 +1,63 @@
+package supervisor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test that the zero Config and DefaultConfig are valid.
+func TestValidateDefaults(t *testing.T) {
+	if err := (Config{}).Validate(); err != nil {
+		t.Fatalf("zero Config: %v", err)
+	}
+	if err := DefaultConfig().Validate(); err != nil {
+		t.Fatalf("DefaultConfig: %v", err)
+	}
+}
+
+// Test that Validate reports every problem at once.
+func TestValidateReportsAll(t *testing.T) {
+	err := Config{
+		MinBackoff:    time.Minute,
+		MaxBackoff:    time.Second,
+		BackoffFactor: 0.5,
+		MaxRestarts:   -1,
+		RunTimeout:    -time.Second,
+		Jitter:        2,
+	}.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	for _, want := range []string{
+		"invalid RunTimeout -1s",
+		"invalid MinBackoff 1m0s: exceeds MaxBackoff 1s",
+		"invalid BackoffFactor 0.5",
+		"invalid Jitter 2",
+		"invalid MaxRestarts -1",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+// Test that MinBackoff is checked against the default MaxBackoff.
+func TestValidateMinBackoffAgainstDefault(t *testing.T) {
+	if err := (Config{MinBackoff: time.Hour}).Validate(); err == nil {
+		t.Fatal("expected MinBackoff above the default MaxBackoff to be invalid")
+	}
+}
+
+// Test that Run rejects an invalid Config without running the worker.
+func TestRunValidates(t *testing.T) {
+	ran := false
+	err := Run(context.Background(), Config{MaxRestarts: -1, Logger: discardLogger}, func(ctx context.Context) {
+		ran = true
+	})
+	if err == nil || ran {
+		t.Fatalf("expected a validation error and no run, got %v (ran=%v)", err, ran)
+	}
+}